@@ -53,6 +53,8 @@ func handler(con net.Conn) {
 	clientChan := make(chan []byte)
 	done := make(chan struct{}, 2)
 	finished := make(chan struct{})
+	srvDecoder := tclientlib.NewDecoder()
+	clientDecoder := tclientlib.NewDecoder()
 	go func() {
 		readBuf := make([]byte, 1024)
 		for {
@@ -93,12 +95,12 @@ func handler(con net.Conn) {
 		case <-done:
 			return
 		case p := <-srvChan:
-			humanText = ConvertHumanText(p)
+			humanText = ConvertHumanText(srvDecoder, p)
 			from = "server send"
 			_, _ = con.Write(p)
 
 		case p := <-clientChan:
-			humanText = ConvertHumanText(p)
+			humanText = ConvertHumanText(clientDecoder, p)
 			from = "client send"
 			_, _ = dstCon.Write(p)
 
@@ -108,32 +110,28 @@ func handler(con net.Conn) {
 	}
 }
 
-func ConvertHumanText(p []byte) []string {
+func ConvertHumanText(decoder *tclientlib.Decoder, p []byte) []string {
 	humanText := make([]string, 0, len(p))
-	if len(p) == 0 {
-		return humanText
-	}
-	remain := p
-	for len(remain) > 0 {
-		var (
-			packet tclientlib.OptionPacket
-			ok     bool
-			code   rune
-		)
-		if packet, remain, ok = tclientlib.ReadOptionPacket(remain); ok {
-			humanText = append(humanText, packet.String())
+	for _, token := range decoder.Decode(p) {
+		if token.Packet != nil {
+			if sub, err := token.Packet.Decode(); err == nil {
+				humanText = append(humanText, fmt.Sprintf("IAC SB %s %+v IAC SE",
+					tclientlib.CodeTOASCII[token.Packet.CommandCode], sub))
+				continue
+			}
+			humanText = append(humanText, token.Packet.String())
 			continue
 		}
-		if code, remain = readRunePacket(remain); code != utf8.RuneError {
+		remain := token.Data
+		for len(remain) > 0 {
+			var code rune
+			code, remain = readRunePacket(remain)
 			if unicode.IsPrint(code) {
 				humanText = append(humanText, string(code))
 			} else {
 				humanText = append(humanText, fmt.Sprintf("%q", code))
 			}
-			continue
 		}
-		log.Println("unknown remain data and break: ", remain)
-		break
 	}
 	return humanText
 }
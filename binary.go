@@ -0,0 +1,51 @@
+package tclientlib
+
+import (
+	"context"
+)
+
+// SetBinary 请求双向启用或关闭 BINARY(RFC 856) 并等待协商结果。
+// BINARY 下 Client.Read/Client.Write 不再处理 NVT 的 CR 规则和 LINEMODE 编辑;
+// 通过 SetBinary 启用时也不做字符集转换, 除 IAC 转义外数据原样传输, 适合传输固件、配置文件等二进制数据。
+// 本端的 BINARY 只能通过 SetBinary 启用, 服务端的 DO BINARY 会被拒绝。
+// 启用时服务端拒绝任一方向都会返回错误, 并关闭已经启用的本端 BINARY。
+// 服务端的 BINARY 需要在 Config.OptionPolicy 的 Remote 中, 否则不发送请求, 返回 ErrOptionRefused。
+// 协商结果由 Client.Read 处理, 调用时需要有其他 goroutine 在读取数据。
+func (c *Client) SetBinary(ctx context.Context, enable bool) error {
+	if enable && !c.policyAllows(BINARY, false) {
+		return ErrOptionRefused
+	}
+	if enable {
+		c.nvt.setRaw(true)
+	}
+	// 本端 BINARY 由调用 SetBinary 表示同意, 不检查 OptionPolicy.Local
+	err := c.waitSwitchOption(ctx, BINARY, true, enable)
+	if err == nil {
+		err = c.switchOption(ctx, BINARY, false, enable)
+		if err != nil && enable {
+			// 服务端拒绝时关闭已经启用的本端 BINARY, 不保留单向的 BINARY
+			_ = c.waitSwitchOption(ctx, BINARY, true, false)
+		}
+	}
+	if !enable || err != nil {
+		c.nvt.setRaw(false)
+	}
+	return err
+}
+
+type binaryHandler struct{}
+
+func (binaryHandler) Accept(c *Client, local bool) bool {
+	return !local
+}
+
+func (binaryHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	if !local {
+		c.nvt.reset()
+	}
+	return nil
+}
+
+func (binaryHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	return nil
+}
@@ -0,0 +1,61 @@
+package tclientlib
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetBinaryRemoteRefused(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		d := NewDecoder()
+		buf := make([]byte, 1024)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, tk := range d.Decode(buf[:n]) {
+				p := tk.Packet
+				if p == nil || p.CommandCode != BINARY {
+					continue
+				}
+				switch p.OptionCode {
+				case WILL:
+					go server.Write([]byte{IAC, DO, BINARY})
+				case DO:
+					go server.Write([]byte{IAC, WONT, BINARY})
+				case WONT:
+					go server.Write([]byte{IAC, DONT, BINARY})
+				}
+			}
+		}
+	}()
+	c, err := NewClientConn(client, &Config{}, WithLogger(func(string, ...interface{}) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := c.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.SetBinary(ctx, true); err != ErrOptionRefused {
+		t.Fatalf("SetBinary() error = %v, want %v", err, ErrOptionRefused)
+	}
+	if c.LocalEnabled(BINARY) || c.RemoteEnabled(BINARY) {
+		t.Errorf("BINARY still enabled: %v", c.Options())
+	}
+	if c.nvt.rawTransfer() {
+		t.Error("raw transfer still enabled")
+	}
+}
@@ -0,0 +1,198 @@
+package tclientlib
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// RFC 2066 CHARSET 子协商命令
+const (
+	CHARSET_REQUEST         = 1
+	CHARSET_ACCEPTED        = 2
+	CHARSET_REJECTED        = 3
+	CHARSET_TTABLE_IS       = 4
+	CHARSET_TTABLE_REJECTED = 5
+	CHARSET_TTABLE_ACK      = 6
+	CHARSET_TTABLE_NAK      = 7
+)
+
+const charsetTTable = "[TTABLE]"
+
+// lookupEncoding 根据 IANA 字符集名称查找编码, UTF-8 返回 nil 表示不需要转码
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %s: %s", name, err)
+	}
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported charset %s", name)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// transcoder 保留不完整的多字节序列, 在下一次调用时继续转换
+type transcoder struct {
+	t       transform.Transformer
+	pending []byte
+}
+
+func (t *transcoder) transform(p []byte) []byte {
+	src := make([]byte, 0, len(t.pending)+len(p))
+	src = append(src, t.pending...)
+	src = append(src, p...)
+	t.pending = nil
+	out := make([]byte, 0, len(src)*2)
+	dst := make([]byte, len(src)*3+utf8Max)
+	for len(src) > 0 {
+		nDst, nSrc, err := t.t.Transform(dst, src, false)
+		out = append(out, dst[:nDst]...)
+		src = src[nSrc:]
+		if err == transform.ErrShortDst {
+			continue
+		}
+		if err != nil && err != transform.ErrShortSrc {
+			traceLogf("[Telnet client] transcode err: %s\r\n", err)
+		}
+		break
+	}
+	t.pending = append(t.pending, src...)
+	return out
+}
+
+const utf8Max = 4
+
+type charsetState struct {
+	mux     sync.Mutex
+	name    string
+	decoder *transcoder // 服务端字符集 -> UTF-8
+	encoder *transcoder // UTF-8 -> 服务端字符集
+}
+
+// set 切换字符集, 未完成的多字节序列会被丢弃
+func (s *charsetState) set(name string) error {
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.name = name
+	s.decoder, s.encoder = nil, nil
+	if enc != nil {
+		s.decoder = &transcoder{t: enc.NewDecoder()}
+		s.encoder = &transcoder{t: encoding.ReplaceUnsupported(enc.NewEncoder())}
+	}
+	return nil
+}
+
+func (s *charsetState) decode(p []byte) []byte {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.decoder == nil {
+		return p
+	}
+	return s.decoder.transform(p)
+}
+
+func (s *charsetState) encode(p []byte) []byte {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.encoder == nil {
+		return p
+	}
+	return s.encoder.transform(p)
+}
+
+// Charset 返回当前服务端使用的字符集, 为空表示不转码
+func (c *Client) Charset() string {
+	c.charset.mux.Lock()
+	defer c.charset.mux.Unlock()
+	return c.charset.name
+}
+
+// handleCharset 处理服务端的 CHARSET 请求, 按 Config.Charsets 的顺序选择双方都支持的字符集
+func (c *Client) handleCharset(params []byte) []OptionPacket {
+	if len(params) == 0 {
+		return nil
+	}
+	reply := OptionPacket{OptionCode: SB, CommandCode: CHARSET}
+	switch params[0] {
+	case CHARSET_REQUEST:
+		name := c.selectCharset(parseCharsetRequest(params[1:]))
+		if name == "" {
+			reply.Parameters = []byte{CHARSET_REJECTED}
+			return []OptionPacket{reply}
+		}
+		if err := c.charset.set(name); err != nil {
+			c.LogF("[Telnet client] set charset %s err: %s", name, err)
+			reply.Parameters = []byte{CHARSET_REJECTED}
+			return []OptionPacket{reply}
+		}
+		c.LogF("[Telnet client] charset accepted: %s", name)
+		reply.Parameters = append([]byte{CHARSET_ACCEPTED}, name...)
+		return []OptionPacket{reply}
+	case CHARSET_TTABLE_IS:
+		reply.Parameters = []byte{CHARSET_TTABLE_REJECTED}
+		return []OptionPacket{reply}
+	}
+	return nil
+}
+
+func (c *Client) selectCharset(offered []string) string {
+	for _, want := range c.conf.Charsets {
+		for _, name := range offered {
+			if !strings.EqualFold(want, name) {
+				continue
+			}
+			if _, err := lookupEncoding(name); err == nil {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// parseCharsetRequest 解析 REQUEST 中的字符集列表, 第一个字节为分隔符
+func parseCharsetRequest(params []byte) []string {
+	if bytes.HasPrefix(params, []byte(charsetTTable)) {
+		// [TTABLE] 后有一个字节的版本号
+		if len(params) <= len(charsetTTable)+1 {
+			return nil
+		}
+		params = params[len(charsetTTable)+1:]
+	}
+	if len(params) < 2 {
+		return nil
+	}
+	var names []string
+	for _, name := range bytes.Split(params[1:], params[:1]) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names
+}
+
+type charsetHandler struct{}
+
+func (charsetHandler) Accept(c *Client, local bool) bool {
+	return len(c.conf.Charsets) > 0
+}
+
+func (charsetHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (charsetHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	return c.handleCharset(params)
+}
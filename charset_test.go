@@ -0,0 +1,54 @@
+package tclientlib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTranscoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   string
+	}{
+		{"whole", [][]byte{{0xc4, 0xe3, 0xba, 0xc3}}, "你好"},
+		{"split in character", [][]byte{{0xc4}, {0xe3, 0xba}, {0xc3}}, "你好"},
+		{"split every byte", [][]byte{{0xc4}, {0xe3}, {0xba}, {0xc3}}, "你好"},
+		{"mixed ascii", [][]byte{{'a', 0xc4}, {0xe3, 'b'}}, "a你b"},
+	}
+	enc, err := lookupEncoding("GBK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &transcoder{t: enc.NewDecoder()}
+			var got []byte
+			for _, chunk := range tt.chunks {
+				got = append(got, tr.transform(chunk)...)
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("transform() = %q, want %q", got, tt.want)
+			}
+			if len(tr.pending) != 0 {
+				t.Errorf("pending = %v, want empty", tr.pending)
+			}
+		})
+	}
+}
+
+func TestTranscoderEncode(t *testing.T) {
+	enc, err := lookupEncoding("GBK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("你好")
+	tr := &transcoder{t: enc.NewEncoder()}
+	var got []byte
+	for i := range src {
+		got = append(got, tr.transform(src[i:i+1])...)
+	}
+	if want := []byte{0xc4, 0xe3, 0xba, 0xc3}; !bytes.Equal(got, want) {
+		t.Errorf("transform() = %x, want %x", got, want)
+	}
+}
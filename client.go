@@ -2,7 +2,8 @@ package tclientlib
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -24,17 +25,74 @@ var defaultStdoutF Log = func(format string, v ...interface{}) {
 }
 
 type Client struct {
-	conf          *Config
-	sock          net.Conn
-	enableWindows bool
-	autoLogin     bool
+	conf      *Config
+	sock      net.Conn
+	autoLogin bool
+
+	optMux  sync.Mutex
+	options [256]optionState
+
+	linemode linemodeState
+	lflow    lflowState
+	charset  charsetState
+	tls      tlsState
+	comPort  comPortState
+	nvt      nvtState
+
+	deadlineMux  sync.Mutex
+	readDeadline time.Time // 调用方通过 Client.SetReadDeadline 设置的读超时
+
+	envMux      sync.Mutex
+	environ     map[string]string
+	userEnviron map[string]string
+
+	waitMux       sync.Mutex
+	dataWaiters   []chan struct{}
+	optionWaiters map[optionKey][]chan bool
+	statusWaiters []chan *StatusReport
+	markWaiters   []*timingMark
 
 	mux         sync.Mutex
+	decoder     Decoder
+	sockBuf     []byte
+	readBuf     []byte
+	received    int64         // 追加到 readBuf 的数据总量
+	flushMarks  []*timingMark // 等待之前的数据被读取的 TM
+	recordEnds  []int64       // 记录边界(IAC EOR/IAC GA)对应的数据位置
 	loginStatus *status
+	ttypeIndex  int
 	LogF        Log
+
+	eventHandler        EventHandler
+	optionChangeHandler OptionChangeHandler
+	handlers            map[byte]OptionHandler
+	customHandlers      map[byte]bool // 通过 WithOptionHandler 注册的选项
 }
 
 func (c *Client) handshake() error {
+	if c.conf.startTLS() && !c.tls.established {
+		if err := c.negotiateTLS(); err != nil {
+			return err
+		}
+	}
+	if c.conf.RequireTLS && !c.tls.established {
+		return ErrTLSRefused
+	}
+	if err := c.requestInitialOptions(); err != nil {
+		return err
+	}
+	if c.autoLogin && !c.conf.DisableNegotiationSettle {
+		ctx, cancel := context.WithTimeout(context.Background(), c.conf.Timeout)
+		err := c.WaitNegotiated(ctx)
+		cancel()
+		switch err {
+		case nil:
+		case context.DeadlineExceeded:
+			c.LogF("[Telnet client] negotiation not settled, continue login")
+		default:
+			return err
+		}
+	}
 	if c.autoLogin {
 		return c.loginAuthentication()
 	}
@@ -76,8 +134,8 @@ func (c *Client) handleLoginData(data []byte) AuthStatus {
 		}
 		for i := range usernameRes {
 			if usernameRes[i] != nil && usernameRes[i].Match(data) {
-				_, _ = c.sock.Write([]byte(c.conf.Username))
-				_, _ = c.sock.Write([]byte{'\r', BINARY})
+				// 行结束符由 Client.Write 按 Config.EOL 转换
+				_, _ = c.Write([]byte(c.conf.Username + "\r"))
 				c.LogF("Username pattern match: %s", bytes.TrimSpace(data))
 				c.loginStatus.usernameDone = true
 				return AuthPartial
@@ -92,8 +150,8 @@ func (c *Client) handleLoginData(data []byte) AuthStatus {
 		}
 		for i := range passwordRes {
 			if passwordRes[i] != nil && passwordRes[i].Match(data) {
-				_, _ = c.sock.Write([]byte(c.conf.Password))
-				_, _ = c.sock.Write([]byte{'\r', BINARY})
+				// 行结束符由 Client.Write 按 Config.EOL 转换
+				_, _ = c.Write([]byte(c.conf.Password + "\r"))
 				c.LogF("Password pattern match: %s", bytes.TrimSpace(data))
 				c.loginStatus.passwordDone = true
 				return AuthPartial
@@ -126,6 +184,20 @@ func (c *Client) handleLoginData(data []byte) AuthStatus {
 	return AUTHUnknown
 }
 
+// nextTermType 依次返回终端类型, 列表结束时重复最后一个, 再次请求时从头开始
+func (c *Client) nextTermType() string {
+	types := c.conf.TTYOptions.terminalTypes()
+	index := c.ttypeIndex
+	if index >= len(types) {
+		index = len(types) - 1
+	}
+	c.ttypeIndex++
+	if c.ttypeIndex > len(types) {
+		c.ttypeIndex = 0
+	}
+	return types[index]
+}
+
 func (c *Client) replyOptionPackets(opts ...OptionPacket) error {
 	var buf bytes.Buffer
 	for i := range opts {
@@ -138,121 +210,130 @@ func (c *Client) replyOptionPackets(opts ...OptionPacket) error {
 func (c *Client) Read(p []byte) (int, error) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	innerBuf := make([]byte, len(p))
-	var (
-		ok     bool
-		nr     int
-		err    error
-		packet OptionPacket
-		remain []byte
-	)
-	// 劫持解析option的包，过滤处理 option packet
-loop:
-	for {
-		nr, err = c.sock.Read(innerBuf)
-		if err != nil {
-			c.LogF("[Telnet client] read err: %s", err)
+	for len(c.readBuf) == 0 {
+		if err := c.fill(); err != nil {
+			if len(c.readBuf) > 0 {
+				break
+			}
 			return 0, err
 		}
-		remain = append(remain, innerBuf[:nr]...)
-		for {
-			if packet, remain, ok = ReadOptionPacket(remain); ok {
-				optPackets := c.handleOptionPacket(packet)
-				if err = c.replyOptionPackets(optPackets...); err != nil {
-					c.LogF("[Telnet client] reply packets err %s", err)
-					return 0, err
-				}
-				traceLogf("[Telnet client] server: %s ----> client: %s\r\n", packet, optPackets)
-				continue
+	}
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	c.releaseTimingMarks()
+	c.dropRecords()
+	return n, nil
+}
+
+// fill 从连接读取一次数据, 过滤处理其中的 option packet, 普通数据追加到 readBuf
+func (c *Client) fill() error {
+	// 劫持解析option的包，过滤处理 option packet
+	nr, err := c.sock.Read(c.sockBuf)
+	if nr > 0 {
+		if err2 := c.handleTokens(c.decoder.Decode(c.sockBuf[:nr])); err2 != nil {
+			return err2
+		}
+	}
+	if err != nil {
+		c.LogF("[Telnet client] read err: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) handleTokens(tokens []Token) error {
+	for i := range tokens {
+		if tokens[i].Packet == nil {
+			data := tokens[i].Data
+			switch {
+			case !c.RemoteEnabled(BINARY):
+				data = c.charset.decode(c.nvt.decode(data, c.conf.EOL))
+			case !c.nvt.rawTransfer():
+				data = c.charset.decode(data)
 			}
-			if packet.OptionCode != 0 || len(remain) == 0 {
-				goto loop
+			c.readBuf = append(c.readBuf, data...)
+			c.received += int64(len(data))
+			c.notifyData()
+			continue
+		}
+		packet := *tokens[i].Packet
+		optPackets := c.handleOptionPacket(packet)
+		if len(optPackets) == 0 {
+			traceLogf("[Telnet client] server: %s\r\n", packet)
+			continue
+		}
+		if err := c.replyOptionPackets(optPackets...); err != nil {
+			c.LogF("[Telnet client] reply packets err %s", err)
+			return err
+		}
+		traceLogf("[Telnet client] server: %s ----> client: %s\r\n", packet, optPackets)
+		if c.tls.pending {
+			if remain := tokens[i+1:]; len(remain) > 0 {
+				traceLogf("[Telnet client] drop %d tokens before TLS handshake\r\n", len(remain))
 			}
-			break loop
+			return c.upgradeTLS()
 		}
 	}
-	return copy(p, remain), err
+	return nil
 }
 
 func (c *Client) handleOptionPacket(p OptionPacket) []OptionPacket {
-	var (
-		replyPacket OptionPacket
-	)
-	replyPacket.CommandCode = p.CommandCode
 	switch p.OptionCode {
-	case SB:
-		replyPacket.OptionCode = SB
-		replyPacket.Parameters = make([]byte, 0)
-		if len(p.Parameters) >= 1 {
-			// subCommand 0 is , 1 Send , 2 INFO
-			// VALUE     1
-			// ESC       2
-			// USERVAR   3
-			switch p.Parameters[0] {
-			case 1:
-				switch p.CommandCode {
-				case OLD_ENVIRON, NEW_ENVIRON:
-					if c.conf.Username != "" {
-						replyPacket.Parameters = append(replyPacket.Parameters, 0)
-						replyPacket.Parameters = append(replyPacket.Parameters, []byte("USER")...)
-						replyPacket.Parameters = append(replyPacket.Parameters, 1)
-						replyPacket.Parameters = append(replyPacket.Parameters, []byte(c.conf.Username)...)
-					}
-				case TSPEED:
-					replyPacket.Parameters = append(replyPacket.Parameters, 0)
-					replyPacket.Parameters = append(replyPacket.Parameters, []byte(fmt.Sprintf(
-						"%d,%d", 38400, 38400))...)
-				case TTYPE:
-					replyPacket.Parameters = append(replyPacket.Parameters, 0)
-					replyPacket.Parameters = append(replyPacket.Parameters, []byte(fmt.Sprintf(
-						"%s", c.conf.TTYOptions.TermType))...)
-				default:
-					replyPacket.OptionCode = WONT
-				}
-			default:
-				replyPacket.OptionCode = WONT
-			}
-		} else {
-			replyPacket.OptionCode = WONT
+	case WILL, WONT:
+		if p.CommandCode == TM && c.notifyTimingMark() {
+			return nil
 		}
+		return c.negotiate(p)
+	case DO, DONT:
+		return c.negotiate(p)
+	case SB:
+		c.emitEvent(SubnegotiationEvent{Option: p.CommandCode, Parameters: p.Parameters})
+		return c.handleSubOption(p)
+	}
+	switch p.OptionCode {
+	case GA, XEOR:
+		c.markRecord()
+	}
+	c.emitEvent(CommandEvent{Command: p.OptionCode})
+	return nil
+}
 
-	case DO:
-		switch p.CommandCode {
-		case TTYPE, TSPEED:
-			replyPacket.OptionCode = WILL
-		case NAWS:
-			replyPacket.OptionCode = WILL
-			c.enableWindows = true
-			// 窗口大小
-			var subOpt OptionPacket
-			subOpt.OptionCode = SB
-			subOpt.CommandCode = NAWS
-			params := make([]byte, 4)
-			binary.BigEndian.PutUint16(params[:2], uint16(c.conf.TTYOptions.Wide))
-			binary.BigEndian.PutUint16(params[2:], uint16(c.conf.TTYOptions.High))
-			subOpt.Parameters = params
-			return []OptionPacket{replyPacket, subOpt}
-		default:
-			replyPacket.OptionCode = WONT
-		}
-	case WILL:
-		switch p.CommandCode {
-		case XDISPLOC:
-			replyPacket.OptionCode = DONT
-		default:
-			replyPacket.OptionCode = DO
+func (c *Client) handleSubOption(p OptionPacket) []OptionPacket {
+	handler, ok := c.handlers[p.CommandCode]
+	if !ok || (!c.LocalEnabled(p.CommandCode) && !c.RemoteEnabled(p.CommandCode)) {
+		traceLogf("[Telnet client] ignore subnegotiation for disabled option: %s\r\n", p)
+		return nil
+	}
+	return handler.Subnegotiation(c, p.Parameters)
+}
+
+// Write 发送用户数据, 数据中的 IAC(0xFF) 会被转义为 IAC IAC, 行结束符按 Config.EOL 转换。
+// 协商 LINEMODE 后按当前模式在本地编辑, 整行发送。BINARY 下不转换行结束符, 见 Client.SetBinary
+func (c *Client) Write(b []byte) (int, error) {
+	var out []byte
+	switch {
+	case c.LocalEnabled(BINARY):
+		if c.nvt.rawTransfer() {
+			out = escapeIAC(b)
+		} else {
+			out = escapeIAC(c.charset.encode(b))
 		}
-	case DONT:
-		replyPacket.OptionCode = WONT
-	case WONT:
-		replyPacket.OptionCode = DONT
+	case c.LocalEnabled(LINEMODE):
+		out = c.nvt.encode(c.linemodeEncode(c.charset.encode(b)), c.conf.EOL)
 	default:
-		c.LogF("match option code unknown: %b", p.OptionCode)
+		out = c.nvt.encode(escapeIAC(c.charset.encode(b)), c.conf.EOL)
 	}
-	return []OptionPacket{replyPacket}
+	if len(out) == 0 {
+		return len(b), nil
+	}
+	if _, err := c.sock.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
 }
 
-func (c *Client) Write(b []byte) (int, error) {
+// WriteRaw 不做任何转义直接发送数据, 用于调用方自行构造的命令序列
+func (c *Client) WriteRaw(b []byte) (int, error) {
 	return c.sock.Write(b)
 }
 
@@ -260,8 +341,24 @@ func (c *Client) Close() error {
 	return c.sock.Close()
 }
 
+// SetReadDeadline 设置读超时, WaitNegotiated 结束后会恢复这里设置的值。
+// 直接在底层连接上设置的读超时会被 WaitNegotiated 清除
+func (c *Client) SetReadDeadline(t time.Time) error {
+	c.deadlineMux.Lock()
+	defer c.deadlineMux.Unlock()
+	c.readDeadline = t
+	return c.sock.SetReadDeadline(t)
+}
+
+// restoreReadDeadline 恢复调用方设置的读超时
+func (c *Client) restoreReadDeadline() {
+	c.deadlineMux.Lock()
+	defer c.deadlineMux.Unlock()
+	_ = c.sock.SetReadDeadline(c.readDeadline)
+}
+
 func (c *Client) WindowChange(w, h int) error {
-	if !c.enableWindows {
+	if !c.LocalEnabled(NAWS) {
 		return nil
 	}
 	if w > MAX_WINDOW_WIDTH {
@@ -270,14 +367,7 @@ func (c *Client) WindowChange(w, h int) error {
 	if h > MAX_WINDOW_HEIGHT {
 		h = MAX_WINDOW_HEIGHT
 	}
-	var p OptionPacket
-	p.OptionCode = SB
-	p.CommandCode = NAWS
-	params := make([]byte, 4)
-	binary.BigEndian.PutUint16(params[:2], uint16(w))
-	binary.BigEndian.PutUint16(params[2:], uint16(h))
-	p.Parameters = params
-	if err := c.replyOptionPackets(p); err != nil {
+	if err := c.replyOptionPackets(nawsPacket(w, h)); err != nil {
 		c.LogF("[Telnet client] window change %s", err)
 		return err
 	}
@@ -287,11 +377,26 @@ func (c *Client) WindowChange(w, h int) error {
 
 }
 
+func nawsPacket(w, h int) OptionPacket {
+	p, _ := EncodeSubnegotiation(&WindowSize{Width: uint16(w), Height: uint16(h)})
+	return p
+}
+
 func Dial(network, addr string, config *Config) (*Client, error) {
 	conn, err := net.DialTimeout(network, addr, config.Timeout)
 	if err != nil {
 		return nil, err
 	}
+	if config.startTLS() && (config.TLSConfig == nil || config.TLSConfig.ServerName == "") {
+		// START_TLS 使用拨号地址作为 SNI 和证书校验的主机名
+		conf := *config
+		conf.TLSConfig = &tls.Config{}
+		if config.TLSConfig != nil {
+			conf.TLSConfig = config.TLSConfig.Clone()
+		}
+		conf.TLSConfig.ServerName = hostname(addr)
+		config = &conf
+	}
 	return NewClientConn(conn, config)
 }
 
@@ -311,14 +416,27 @@ func NewClientConn(conn net.Conn, config *Config, opts ...Opt) (*Client, error)
 		autoLogin = true
 	}
 	client := &Client{
-		sock:      conn,
-		conf:      &fullConf,
-		autoLogin: autoLogin,
+		sock:           conn,
+		conf:           &fullConf,
+		autoLogin:      autoLogin,
+		sockBuf:        make([]byte, 1024*4),
+		handlers:       defaultOptionHandlers(),
+		customHandlers: make(map[byte]bool),
 		loginStatus: &status{
 			usernameDone: false,
 			passwordDone: false,
 		},
 	}
+	if _, ok := conn.(*tls.Conn); ok {
+		client.tls.established = true
+	}
+	client.initEnviron()
+	if fullConf.Encoding != "" {
+		if err := client.charset.set(fullConf.Encoding); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("telnet: %s", err)
+		}
+	}
 	client.LogF = defaultStdoutF
 	for _, opt := range opts {
 		opt(client)
@@ -0,0 +1,82 @@
+package tclientlib
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrInvalidCommand = errors.New("invalid telnet command")
+
+// SendCommand 发送 IAC 命令, 仅支持 NOP、DM、BRK、IP、AO、AYT、EC、EL、GA、EOF、SUSP 和 ABORT
+func (c *Client) SendCommand(cmd byte) error {
+	switch cmd {
+	case NOP, DM, BRK, IP, AO, AYT, EC, EL, GA, XEOF, SUSP, ABORT:
+	default:
+		return ErrInvalidCommand
+	}
+	packet := OptionPacket{OptionCode: cmd}
+	_, err := c.sock.Write(packet.Bytes())
+	traceLogf("[Telnet client] client: %s\r\n", packet)
+	return err
+}
+
+func (c *Client) SendBreak() error {
+	return c.SendCommand(BRK)
+}
+
+func (c *Client) InterruptProcess() error {
+	return c.SendCommand(IP)
+}
+
+func (c *Client) AbortOutput() error {
+	return c.SendCommand(AO)
+}
+
+func (c *Client) EraseCharacter() error {
+	return c.SendCommand(EC)
+}
+
+func (c *Client) EraseLine() error {
+	return c.SendCommand(EL)
+}
+
+func (c *Client) GoAhead() error {
+	return c.SendCommand(GA)
+}
+
+func (c *Client) NoOperation() error {
+	return c.SendCommand(NOP)
+}
+
+// AreYouThere 发送 IAC AYT 并等待服务端的回复数据。
+// 回复由 Client.Read 处理, 调用时需要有其他 goroutine 在读取数据。
+func (c *Client) AreYouThere(ctx context.Context) error {
+	received := c.waitData()
+	if err := c.SendCommand(AYT); err != nil {
+		return err
+	}
+	select {
+	case <-received:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitData 返回的 channel 在 Client.Read 下一次收到数据时关闭
+func (c *Client) waitData() <-chan struct{} {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	ch := make(chan struct{})
+	c.dataWaiters = append(c.dataWaiters, ch)
+	return ch
+}
+
+func (c *Client) notifyData() {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	for i := range c.dataWaiters {
+		close(c.dataWaiters[i])
+	}
+	c.dataWaiters = nil
+}
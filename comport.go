@@ -0,0 +1,389 @@
+package tclientlib
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RFC 2217 COM-PORT-OPTION 命令, 服务端的回复为对应命令加 100
+const (
+	CPO_SIGNATURE           = 0
+	CPO_SET_BAUDRATE        = 1
+	CPO_SET_DATASIZE        = 2
+	CPO_SET_PARITY          = 3
+	CPO_SET_STOPSIZE        = 4
+	CPO_SET_CONTROL         = 5
+	CPO_NOTIFY_LINESTATE    = 6
+	CPO_NOTIFY_MODEMSTATE   = 7
+	CPO_FLOWCONTROL_SUSPEND = 8
+	CPO_FLOWCONTROL_RESUME  = 9
+	CPO_SET_LINESTATE_MASK  = 10
+	CPO_SET_MODEMSTATE_MASK = 11
+	CPO_PURGE_DATA          = 12
+
+	CPO_SERVER_OFFSET = 100
+)
+
+// SET-PARITY 参数
+const (
+	PARITY_NONE  = 1
+	PARITY_ODD   = 2
+	PARITY_EVEN  = 3
+	PARITY_MARK  = 4
+	PARITY_SPACE = 5
+)
+
+// SET-STOPSIZE 参数
+const (
+	STOPSIZE_1   = 1
+	STOPSIZE_2   = 2
+	STOPSIZE_1_5 = 3
+)
+
+// SET-CONTROL 参数
+const (
+	CONTROL_FLOW_REQUEST          = 0
+	CONTROL_FLOW_NONE             = 1
+	CONTROL_FLOW_XONXOFF          = 2
+	CONTROL_FLOW_HARDWARE         = 3
+	CONTROL_BREAK_REQUEST         = 4
+	CONTROL_BREAK_ON              = 5
+	CONTROL_BREAK_OFF             = 6
+	CONTROL_DTR_REQUEST           = 7
+	CONTROL_DTR_ON                = 8
+	CONTROL_DTR_OFF               = 9
+	CONTROL_RTS_REQUEST           = 10
+	CONTROL_RTS_ON                = 11
+	CONTROL_RTS_OFF               = 12
+	CONTROL_INBOUND_FLOW_REQUEST  = 13
+	CONTROL_INBOUND_FLOW_NONE     = 14
+	CONTROL_INBOUND_FLOW_XONXOFF  = 15
+	CONTROL_INBOUND_FLOW_HARDWARE = 16
+	CONTROL_FLOW_DCD              = 17
+	CONTROL_INBOUND_FLOW_DTR      = 18
+	CONTROL_FLOW_DSR              = 19
+)
+
+// NOTIFY-LINESTATE 标志位
+const (
+	LINESTATE_DATA_READY    = 0x01
+	LINESTATE_OVERRUN_ERROR = 0x02
+	LINESTATE_PARITY_ERROR  = 0x04
+	LINESTATE_FRAMING_ERROR = 0x08
+	LINESTATE_BREAK_DETECT  = 0x10
+	LINESTATE_THRE          = 0x20 // Transfer Holding Register Empty
+	LINESTATE_TSRE          = 0x40 // Transfer Shift Register Empty
+	LINESTATE_TIMEOUT       = 0x80
+)
+
+// NOTIFY-MODEMSTATE 标志位
+const (
+	MODEMSTATE_DELTA_CTS = 0x01
+	MODEMSTATE_DELTA_DSR = 0x02
+	MODEMSTATE_TERI      = 0x04 // Trailing edge ring detector
+	MODEMSTATE_DELTA_CD  = 0x08
+	MODEMSTATE_CTS       = 0x10
+	MODEMSTATE_DSR       = 0x20
+	MODEMSTATE_RI        = 0x40
+	MODEMSTATE_CD        = 0x80
+)
+
+// PURGE-DATA 参数
+const (
+	PURGE_RECEIVE  = 1
+	PURGE_TRANSMIT = 2
+	PURGE_BOTH     = 3
+)
+
+const comPortSignature = "tclientlib"
+
+// LineStateEvent 收到服务端的 NOTIFY-LINESTATE
+type LineStateEvent struct {
+	State byte
+}
+
+func (e LineStateEvent) String() string {
+	return fmt.Sprintf("com port line state: %#02x", e.State)
+}
+
+// ModemStateEvent 收到服务端的 NOTIFY-MODEMSTATE
+type ModemStateEvent struct {
+	State byte
+}
+
+func (e ModemStateEvent) String() string {
+	return fmt.Sprintf("com port modem state: %#02x", e.State)
+}
+
+type comPortState struct {
+	mux        sync.Mutex
+	lineState  byte
+	modemState byte
+	suspended  bool
+	waiters    map[byte][]chan []byte
+}
+
+// ComPort 通过 RFC 2217 控制终端服务器上的串口, 服务端的回复由 Client.Read 处理,
+// 调用时需要有其他 goroutine 在读取数据
+type ComPort struct {
+	client *Client
+}
+
+// ComPort 发送 WILL COM-PORT-OPTION 并等待服务端同意
+func (c *Client) ComPort(ctx context.Context) (*ComPort, error) {
+	if err := c.enableOption(ctx, COM_PORT_OPTION, true); err != nil {
+		return nil, err
+	}
+	return &ComPort{client: c}, nil
+}
+
+// Signature 查询服务端的签名
+func (p *ComPort) Signature(ctx context.Context) (string, error) {
+	reply, err := p.request(ctx, CPO_SIGNATURE, nil)
+	return string(reply), err
+}
+
+// SetBaudRate 设置波特率, 0 表示查询当前值, 返回服务端实际使用的波特率
+func (p *ComPort) SetBaudRate(ctx context.Context, baud uint32) (uint32, error) {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, baud)
+	reply, err := p.request(ctx, CPO_SET_BAUDRATE, value)
+	if err != nil {
+		return 0, err
+	}
+	if len(reply) != 4 {
+		return 0, fmt.Errorf("com port: invalid baud rate reply %v", reply)
+	}
+	return binary.BigEndian.Uint32(reply), nil
+}
+
+// SetDataSize 设置数据位(5-8), 0 表示查询当前值
+func (p *ComPort) SetDataSize(ctx context.Context, size byte) (byte, error) {
+	return p.requestByte(ctx, CPO_SET_DATASIZE, size)
+}
+
+// SetParity 设置校验方式(PARITY_*), 0 表示查询当前值
+func (p *ComPort) SetParity(ctx context.Context, parity byte) (byte, error) {
+	return p.requestByte(ctx, CPO_SET_PARITY, parity)
+}
+
+// SetStopSize 设置停止位(STOPSIZE_*), 0 表示查询当前值
+func (p *ComPort) SetStopSize(ctx context.Context, size byte) (byte, error) {
+	return p.requestByte(ctx, CPO_SET_STOPSIZE, size)
+}
+
+// SetControl 发送 SET-CONTROL(CONTROL_*), 返回服务端的当前状态
+func (p *ComPort) SetControl(ctx context.Context, control byte) (byte, error) {
+	return p.requestByte(ctx, CPO_SET_CONTROL, control)
+}
+
+// SetFlowControl 设置出方向流控(CONTROL_FLOW_NONE、CONTROL_FLOW_XONXOFF 或 CONTROL_FLOW_HARDWARE)
+func (p *ComPort) SetFlowControl(ctx context.Context, flow byte) error {
+	_, err := p.SetControl(ctx, flow)
+	return err
+}
+
+func (p *ComPort) SetDTR(ctx context.Context, on bool) error {
+	control := byte(CONTROL_DTR_OFF)
+	if on {
+		control = CONTROL_DTR_ON
+	}
+	_, err := p.SetControl(ctx, control)
+	return err
+}
+
+func (p *ComPort) SetRTS(ctx context.Context, on bool) error {
+	control := byte(CONTROL_RTS_OFF)
+	if on {
+		control = CONTROL_RTS_ON
+	}
+	_, err := p.SetControl(ctx, control)
+	return err
+}
+
+func (p *ComPort) SetBreak(ctx context.Context, on bool) error {
+	control := byte(CONTROL_BREAK_OFF)
+	if on {
+		control = CONTROL_BREAK_ON
+	}
+	_, err := p.SetControl(ctx, control)
+	return err
+}
+
+// SendBreak 在串口上保持 BREAK 状态 duration 后恢复
+func (p *ComPort) SendBreak(ctx context.Context, duration time.Duration) error {
+	if err := p.SetBreak(ctx, true); err != nil {
+		return err
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	// 即使 ctx 已取消也要尝试恢复 BREAK 状态
+	return p.SetBreak(context.Background(), false)
+}
+
+// SetLineStateMask 设置服务端需要通知的 line state 标志位
+func (p *ComPort) SetLineStateMask(ctx context.Context, mask byte) error {
+	_, err := p.requestByte(ctx, CPO_SET_LINESTATE_MASK, mask)
+	return err
+}
+
+// SetModemStateMask 设置服务端需要通知的 modem state 标志位
+func (p *ComPort) SetModemStateMask(ctx context.Context, mask byte) error {
+	_, err := p.requestByte(ctx, CPO_SET_MODEMSTATE_MASK, mask)
+	return err
+}
+
+// PurgeData 清空服务端的串口缓冲区(PURGE_*)
+func (p *ComPort) PurgeData(ctx context.Context, which byte) error {
+	_, err := p.requestByte(ctx, CPO_PURGE_DATA, which)
+	return err
+}
+
+// LineState 返回服务端最近一次通知的 line state
+func (p *ComPort) LineState() byte {
+	s := &p.client.comPort
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.lineState
+}
+
+// ModemState 返回服务端最近一次通知的 modem state
+func (p *ComPort) ModemState() byte {
+	s := &p.client.comPort
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.modemState
+}
+
+// Suspended 报告服务端是否要求暂停发送数据(FLOWCONTROL-SUSPEND)
+func (p *ComPort) Suspended() bool {
+	s := &p.client.comPort
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.suspended
+}
+
+func (p *ComPort) requestByte(ctx context.Context, command, value byte) (byte, error) {
+	reply, err := p.request(ctx, command, []byte{value})
+	if err != nil {
+		return 0, err
+	}
+	if len(reply) != 1 {
+		return 0, fmt.Errorf("com port: invalid reply %v for command %d", reply, command)
+	}
+	return reply[0], nil
+}
+
+// request 发送命令并等待服务端对应的回复
+func (p *ComPort) request(ctx context.Context, command byte, value []byte) ([]byte, error) {
+	c := p.client
+	received := c.comPort.wait(command + CPO_SERVER_OFFSET)
+	defer c.comPort.cancelWait(command+CPO_SERVER_OFFSET, received)
+	params := append([]byte{command}, value...)
+	packet := OptionPacket{OptionCode: SB, CommandCode: COM_PORT_OPTION, Parameters: params}
+	traceLogf("[Telnet client] client: %s\r\n", packet)
+	if err := c.replyOptionPackets(packet); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-received:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) handleComPort(params []byte) []OptionPacket {
+	if len(params) == 0 {
+		return nil
+	}
+	command, value := params[0], params[1:]
+	s := &c.comPort
+	switch command {
+	case CPO_SIGNATURE + CPO_SERVER_OFFSET:
+		if len(value) == 0 {
+			// 服务端查询 client 的签名
+			params := append([]byte{CPO_SIGNATURE}, comPortSignature...)
+			return []OptionPacket{{OptionCode: SB, CommandCode: COM_PORT_OPTION, Parameters: params}}
+		}
+	case CPO_NOTIFY_LINESTATE + CPO_SERVER_OFFSET:
+		if len(value) > 0 {
+			s.mux.Lock()
+			s.lineState = value[0]
+			s.mux.Unlock()
+			c.emitEvent(LineStateEvent{State: value[0]})
+		}
+		return nil
+	case CPO_NOTIFY_MODEMSTATE + CPO_SERVER_OFFSET:
+		if len(value) > 0 {
+			s.mux.Lock()
+			s.modemState = value[0]
+			s.mux.Unlock()
+			c.emitEvent(ModemStateEvent{State: value[0]})
+		}
+		return nil
+	case CPO_FLOWCONTROL_SUSPEND + CPO_SERVER_OFFSET, CPO_FLOWCONTROL_RESUME + CPO_SERVER_OFFSET:
+		s.mux.Lock()
+		s.suspended = command == CPO_FLOWCONTROL_SUSPEND+CPO_SERVER_OFFSET
+		s.mux.Unlock()
+		return nil
+	}
+	s.notify(command, value)
+	return nil
+}
+
+func (s *comPortState) wait(command byte) chan []byte {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ch := make(chan []byte, 1)
+	if s.waiters == nil {
+		s.waiters = make(map[byte][]chan []byte)
+	}
+	s.waiters[command] = append(s.waiters[command], ch)
+	return ch
+}
+
+func (s *comPortState) cancelWait(command byte, ch chan []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	waiters := s.waiters[command]
+	for i := range waiters {
+		if waiters[i] == ch {
+			s.waiters[command] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *comPortState) notify(command byte, value []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, ch := range s.waiters[command] {
+		ch <- value
+	}
+	delete(s.waiters, command)
+}
+
+type comPortHandler struct{}
+
+func (comPortHandler) Accept(c *Client, local bool) bool {
+	return local
+}
+
+func (comPortHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (comPortHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !c.LocalEnabled(COM_PORT_OPTION) {
+		return nil
+	}
+	return c.handleComPort(params)
+}
@@ -1,6 +1,8 @@
 package tclientlib
 
 import (
+	"crypto/tls"
+	"fmt"
 	"regexp"
 	"time"
 )
@@ -9,6 +11,39 @@ type TerminalOptions struct {
 	Wide     int
 	High     int
 	TermType string
+
+	// TermTypes 按顺序回复服务端的 TTYPE SEND 请求(RFC 1091), 为空时只使用 TermType。
+	// 可以包含 MTTS 风格的条目, 如 "MTTS 137"
+	TermTypes []string
+
+	// TSPEED(RFC 1079) 回复的发送和接收速率, 都为 0 时拒绝 TSPEED
+	TransmitSpeed int
+	ReceiveSpeed  int
+
+	// XDISPLOC(RFC 1096) 回复的 X display 位置, 如 "host:0.0", 为空时拒绝 XDISPLOC
+	XDisplayLocation string
+}
+
+// terminalSpeed 返回 TSPEED 的回复内容, 只设置了一个速率时两个方向使用相同的值
+func (t *TerminalOptions) terminalSpeed() string {
+	transmit, receive := t.TransmitSpeed, t.ReceiveSpeed
+	if transmit == 0 {
+		transmit = receive
+	}
+	if receive == 0 {
+		receive = transmit
+	}
+	if transmit == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d", transmit, receive)
+}
+
+func (t *TerminalOptions) terminalTypes() []string {
+	if len(t.TermTypes) > 0 {
+		return t.TermTypes
+	}
+	return []string{t.TermType}
 }
 
 func defaultTerminalOptions() TerminalOptions {
@@ -25,6 +60,45 @@ type Config struct {
 	Timeout    time.Duration
 	TTYOptions *TerminalOptions
 
+	// NEW_ENVIRON 变量, 未设置 USER 时使用 Username
+	Environ     map[string]string
+	UserEnviron map[string]string
+
+	// 同意服务端的 DO LINEMODE(RFC 1184), 由 Client.Write 在本地编辑并按行发送
+	Linemode bool
+
+	// Encoding 是服务端默认使用的字符集(IANA 名称), 如 "GBK"、"GB18030",
+	// Client.Read/Client.Write 会与 UTF-8 相互转换, 为空时不转码
+	Encoding string
+	// Charsets 是 CHARSET(RFC 2066) 协商时可以接受的字符集, 按优先级排列, 为空时拒绝 CHARSET
+	Charsets []string
+
+	// TLSConfig 不为空时在登录前通过 START_TLS 将连接升级为 TLS, 设置 RequireTLS 或 TLSFingerprints 时同样会进行。
+	// NewClientConn 不知道服务端的主机名, 需要校验证书时必须设置 ServerName, 否则返回 ErrTLSServerName;
+	// Dial 未设置 ServerName 时使用拨号地址中的主机名
+	TLSConfig *tls.Config
+	// RequireTLS 为 true 时服务端拒绝 START_TLS 则握手失败, 不会以明文登录
+	RequireTLS bool
+	// TLSFingerprints 是允许的服务端证书 SHA-256 指纹(十六进制, 可包含冒号),
+	// 设置后只校验指纹, 不校验证书链
+	TLSFingerprints []string
+
+	// EOL 是非 BINARY 模式下行结束符的转换方式, 默认为 EOLRaw
+	EOL EOLPolicy
+
+	// OptionPolicy 是允许服务端启用的选项, 为空时使用 PermissiveOptionPolicy
+	OptionPolicy *OptionPolicy
+	// RequestLocal 是连接后在登录前主动发送 WILL 的选项, 如 NAWS、TTYPE、NEW_ENVIRON,
+	// 用于不会主动发送 DO 的服务端
+	RequestLocal []byte
+	// RequestRemote 是连接后在登录前主动发送 DO 的选项, 如 SGA、ECHO
+	RequestRemote []byte
+
+	// DisableNegotiationSettle 为 true 时自动登录前不等待初始的选项协商完成(Client.WaitNegotiated)
+	DisableNegotiationSettle bool
+	// NegotiationQuietPeriod 是服务端不回应 TM 时判定协商结束的静默时间, 默认 500ms
+	NegotiationQuietPeriod time.Duration
+
 	UsernamePromptRegex     *regexp.Regexp
 	PasswordPromptRegex     *regexp.Regexp
 	LoginSuccessPromptRegex *regexp.Regexp
@@ -54,6 +128,12 @@ func (conf *Config) SetDefaults() {
 			opts.TermType = "xterm"
 		}
 	}
+	if conf.NegotiationQuietPeriod == 0 {
+		conf.NegotiationQuietPeriod = defaultNegotiationQuietPeriod
+	}
+	if conf.OptionPolicy == nil {
+		conf.OptionPolicy = PermissiveOptionPolicy()
+	}
 	if conf.BuiltinUsernamePromptRegex == nil {
 		conf.BuiltinUsernamePromptRegex = DefaultUsernamePattern
 	}
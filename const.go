@@ -10,14 +10,27 @@ var CodeTOASCII = map[byte]string{
 	WONT:           "WONT",
 	DO:             "DO",
 	DONT:           "DONT",
+	XEOF:           "EOF",
+	XEOR:           "EOR",
+	SUSP:           "SUSP",
+	ABORT:          "ABORT",
 	SE:             "SE",
 	SB:             "SB",
+	NOP:            "NOP",
+	DM:             "DM",
+	BRK:            "BRK",
+	IP:             "IP",
+	AO:             "AO",
+	AYT:            "AYT",
+	EC:             "EC",
+	EL:             "EL",
+	GA:             "GA",
 	BINARY:         "BINARY",
 	ECHO:           "ECHO",
 	RCP:            "RCP",
 	SGA:            "SGA",
 	NAMS:           "NAMS",
-	STATUS:         "STATUS ",
+	STATUS:         "STATUS",
 	TM:             "TM",
 	RCTE:           "RCTE",
 	NAOL:           "NAOL",
@@ -52,6 +65,10 @@ var CodeTOASCII = map[byte]string{
 	AUTHENTICATION: "AUTHENTICATION",
 	ENCRYPT:        "ENCRYPT",
 	NEW_ENVIRON:    "NEW_ENVIRON",
+
+	CHARSET:         "CHARSET",
+	COM_PORT_OPTION: "COM_PORT_OPTION",
+	START_TLS:       "START_TLS",
 }
 
 const (
@@ -0,0 +1,142 @@
+package tclientlib
+
+type decodeState int
+
+const (
+	stateData      decodeState = iota // 普通数据
+	stateIAC                          // 收到 IAC
+	stateNegotiate                    // 收到 IAC WILL/WONT/DO/DONT, 等待 option
+	stateSB                           // 收到 IAC SB, 等待 option
+	stateSBData                       // 子协商参数
+	stateSBIAC                        // 子协商参数中收到 IAC
+)
+
+// Token 是 Decoder 的解析结果, Packet 为 nil 时 Data 为普通数据
+type Token struct {
+	Data   []byte
+	Packet *OptionPacket
+}
+
+// Decoder 逐字节解析 telnet 数据流, 不完整的帧会保留到下一次 Decode 调用
+type Decoder struct {
+	state  decodeState
+	verb   byte
+	option byte
+	params []byte
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Decode 按顺序返回 p 中的数据和协议包, IAC IAC 会被还原为 0xFF 数据
+func (d *Decoder) Decode(p []byte) []Token {
+	var (
+		tokens []Token
+		data   []byte
+	)
+	flush := func() {
+		if len(data) > 0 {
+			tokens = append(tokens, Token{Data: data})
+			data = nil
+		}
+	}
+	for _, b := range p {
+		packets, isData := d.decodeByte(b)
+		if isData {
+			data = append(data, b)
+			continue
+		}
+		if len(packets) > 0 {
+			flush()
+		}
+		for i := range packets {
+			tokens = append(tokens, Token{Packet: packets[i]})
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Pending 报告是否存在未解析完成的帧
+func (d *Decoder) Pending() bool {
+	return d.state != stateData
+}
+
+func (d *Decoder) Reset() {
+	d.state = stateData
+	d.verb = 0
+	d.option = 0
+	d.params = nil
+}
+
+func (d *Decoder) decodeByte(b byte) (packets []*OptionPacket, isData bool) {
+	switch d.state {
+	case stateData:
+		if b == IAC {
+			d.state = stateIAC
+			return nil, false
+		}
+		return nil, true
+	case stateIAC:
+		return d.decodeCommand(b)
+	case stateNegotiate:
+		d.state = stateData
+		return []*OptionPacket{{OptionCode: d.verb, CommandCode: b}}, false
+	case stateSB:
+		d.option = b
+		d.params = make([]byte, 0)
+		d.state = stateSBData
+		return nil, false
+	case stateSBData:
+		if b == IAC {
+			d.state = stateSBIAC
+			return nil, false
+		}
+		d.params = append(d.params, b)
+		return nil, false
+	case stateSBIAC:
+		switch b {
+		case IAC:
+			d.params = append(d.params, IAC)
+			d.state = stateSBData
+			return nil, false
+		case SE:
+			d.state = stateData
+			return []*OptionPacket{d.subnegotiation()}, false
+		default:
+			// 缺少 IAC SE 的子协商, 先结束子协商, 再按命令处理当前字节
+			traceLogf("subnegotiation %s terminated by IAC %d\r\n", CodeTOASCII[d.option], b)
+			packets = append(packets, d.subnegotiation())
+			next, _ := d.decodeCommand(b)
+			return append(packets, next...), false
+		}
+	}
+	d.Reset()
+	return nil, false
+}
+
+func (d *Decoder) decodeCommand(b byte) (packets []*OptionPacket, isData bool) {
+	switch b {
+	case IAC:
+		d.state = stateData
+		return nil, true
+	case WILL, WONT, DO, DONT:
+		d.verb = b
+		d.state = stateNegotiate
+		return nil, false
+	case SB:
+		d.state = stateSB
+		return nil, false
+	default:
+		d.state = stateData
+		return []*OptionPacket{{OptionCode: b}}, false
+	}
+}
+
+func (d *Decoder) subnegotiation() *OptionPacket {
+	packet := &OptionPacket{OptionCode: SB, CommandCode: d.option, Parameters: d.params}
+	d.option = 0
+	d.params = nil
+	return packet
+}
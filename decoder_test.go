@@ -0,0 +1,191 @@
+package tclientlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		want    []Token
+		pending bool
+	}{
+		{
+			name:   "data",
+			chunks: [][]byte{[]byte("hello")},
+			want:   []Token{{Data: []byte("hello")}},
+		},
+		{
+			name:   "IAC IAC outside SB",
+			chunks: [][]byte{{'a', IAC, IAC, 'b'}},
+			want:   []Token{{Data: []byte{'a', IAC, 'b'}}},
+		},
+		{
+			name:   "IAC IAC split across calls",
+			chunks: [][]byte{{'a', IAC}, {IAC, 'b'}},
+			want:   []Token{{Data: []byte{'a', IAC, 'b'}}},
+		},
+		{
+			name:   "negotiation",
+			chunks: [][]byte{{'a', IAC, WILL, ECHO, 'b'}},
+			want: []Token{
+				{Data: []byte("a")},
+				{Packet: &OptionPacket{OptionCode: WILL, CommandCode: ECHO}},
+				{Data: []byte("b")},
+			},
+		},
+		{
+			name:   "negotiation split across calls",
+			chunks: [][]byte{{IAC}, {DO}, {NAWS}},
+			want:   []Token{{Packet: &OptionPacket{OptionCode: DO, CommandCode: NAWS}}},
+		},
+		{
+			name:   "command",
+			chunks: [][]byte{{IAC, GA}},
+			want:   []Token{{Packet: &OptionPacket{OptionCode: GA}}},
+		},
+		{
+			name:   "subnegotiation",
+			chunks: [][]byte{{IAC, SB, TTYPE, TELQUAL_SEND, IAC, SE}},
+			want: []Token{
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{TELQUAL_SEND}}},
+			},
+		},
+		{
+			name:   "subnegotiation split across calls",
+			chunks: [][]byte{{'a', IAC, SB}, {TTYPE, TELQUAL_SEND}, {IAC}, {SE, 'b'}},
+			want: []Token{
+				{Data: []byte("a")},
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{TELQUAL_SEND}}},
+				{Data: []byte("b")},
+			},
+		},
+		{
+			name:   "IAC IAC inside SB",
+			chunks: [][]byte{{IAC, SB, NAWS, 0, IAC, IAC, 0, 24, IAC, SE}},
+			want: []Token{
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: NAWS, Parameters: []byte{0, IAC, 0, 24}}},
+			},
+		},
+		{
+			name:   "IAC IAC inside SB split across calls",
+			chunks: [][]byte{{IAC, SB, NAWS, 0, IAC}, {IAC, 0, 24, IAC, SE}},
+			want: []Token{
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: NAWS, Parameters: []byte{0, IAC, 0, 24}}},
+			},
+		},
+		{
+			name:   "SE byte in SB parameters",
+			chunks: [][]byte{{IAC, SB, NAWS, 0, SE, 0, SE, IAC, SE}},
+			want: []Token{
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: NAWS, Parameters: []byte{0, SE, 0, SE}}},
+			},
+		},
+		{
+			name:   "SB terminated by other command",
+			chunks: [][]byte{{IAC, SB, TTYPE, 'x', IAC, WILL, ECHO}},
+			want: []Token{
+				{Packet: &OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{'x'}}},
+				{Packet: &OptionPacket{OptionCode: WILL, CommandCode: ECHO}},
+			},
+		},
+		{
+			name:    "incomplete SB",
+			chunks:  [][]byte{{'a', IAC, SB, TTYPE, 'x'}},
+			want:    []Token{{Data: []byte("a")}},
+			pending: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder()
+			var got []Token
+			for _, chunk := range tt.chunks {
+				got = appendTokens(got, d.Decode(chunk))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+			if d.Pending() != tt.pending {
+				t.Errorf("Pending() = %v, want %v", d.Pending(), tt.pending)
+			}
+		})
+	}
+}
+
+// appendTokens 合并相邻的数据, 数据在不同的 Decode 调用中返回时结果一致
+func appendTokens(tokens, next []Token) []Token {
+	for _, tk := range next {
+		if n := len(tokens); n > 0 && tk.Packet == nil && tokens[n-1].Packet == nil {
+			tokens[n-1].Data = append(tokens[n-1].Data, tk.Data...)
+			continue
+		}
+		tokens = append(tokens, tk)
+	}
+	return tokens
+}
+
+func TestReadOptionPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      []byte
+		packet OptionPacket
+		rest   []byte
+		ok     bool
+	}{
+		{
+			name: "no IAC",
+			p:    []byte("abc"),
+			rest: []byte("abc"),
+		},
+		{
+			name:   "negotiation",
+			p:      []byte{'a', IAC, WILL, ECHO, 'b'},
+			packet: OptionPacket{OptionCode: WILL, CommandCode: ECHO},
+			rest:   []byte("ab"),
+			ok:     true,
+		},
+		{
+			name:   "subnegotiation",
+			p:      []byte{'a', IAC, SB, TTYPE, TELQUAL_SEND, IAC, SE, 'b'},
+			packet: OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{TELQUAL_SEND}},
+			rest:   []byte("ab"),
+			ok:     true,
+		},
+		{
+			name:   "subnegotiation terminated by negotiation",
+			p:      []byte{'a', IAC, SB, TTYPE, 'x', IAC, WILL, ECHO, 'b'},
+			packet: OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{'x'}},
+			rest:   []byte{'a', IAC, WILL, ECHO, 'b'},
+			ok:     true,
+		},
+		{
+			name:   "subnegotiation terminated by command",
+			p:      []byte{IAC, SB, TTYPE, 'x', IAC, GA, 'b'},
+			packet: OptionPacket{OptionCode: SB, CommandCode: TTYPE, Parameters: []byte{'x'}},
+			rest:   []byte{IAC, GA, 'b'},
+			ok:     true,
+		},
+		{
+			name: "escaped IAC",
+			p:    []byte{'a', IAC, IAC},
+			rest: []byte{'a', IAC, IAC},
+		},
+		{
+			name: "incomplete",
+			p:    []byte{'a', IAC, SB, TTYPE},
+			rest: []byte{'a', IAC, SB, TTYPE},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, rest, ok := ReadOptionPacket(tt.p)
+			if !reflect.DeepEqual(packet, tt.packet) || !reflect.DeepEqual(rest, tt.rest) || ok != tt.ok {
+				t.Errorf("ReadOptionPacket(%v) = %v, %v, %v, want %v, %v, %v",
+					tt.p, packet, rest, ok, tt.packet, tt.rest, tt.ok)
+			}
+		})
+	}
+}
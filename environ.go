@@ -0,0 +1,182 @@
+package tclientlib
+
+import (
+	"bytes"
+	"sort"
+)
+
+// RFC 1572 NEW_ENVIRON 参数类型
+const (
+	ENV_VAR     = 0
+	ENV_VALUE   = 1
+	ENV_ESC     = 2
+	ENV_USERVAR = 3
+)
+
+func (c *Client) initEnviron() {
+	c.environ = make(map[string]string, len(c.conf.Environ)+1)
+	c.userEnviron = make(map[string]string, len(c.conf.UserEnviron))
+	for name, value := range c.conf.Environ {
+		c.environ[name] = value
+	}
+	for name, value := range c.conf.UserEnviron {
+		c.userEnviron[name] = value
+	}
+	if _, ok := c.environ["USER"]; !ok && c.conf.Username != "" {
+		c.environ["USER"] = c.conf.Username
+	}
+}
+
+func (c *Client) hasEnviron() bool {
+	c.envMux.Lock()
+	defer c.envMux.Unlock()
+	return len(c.environ) > 0 || len(c.userEnviron) > 0
+}
+
+// environReply 根据服务端 SEND 请求的变量列表生成 IS 回复的内容, 列表为空时发送全部变量
+func (c *Client) environReply(params []byte) []byte {
+	c.envMux.Lock()
+	defer c.envMux.Unlock()
+	requests := parseEnvironVars(params)
+	if len(requests) == 0 {
+		requests = []EnvironVar{{Type: ENV_VAR}, {Type: ENV_USERVAR}}
+	}
+	var buf bytes.Buffer
+	for _, req := range requests {
+		vars := c.environ
+		if req.Type == ENV_USERVAR {
+			vars = c.userEnviron
+		}
+		if req.Name == "" {
+			for _, name := range sortedEnvironNames(vars) {
+				writeEnvironVar(&buf, req.Type, name, vars[name], true)
+			}
+			continue
+		}
+		value, ok := vars[req.Name]
+		writeEnvironVar(&buf, req.Type, req.Name, value, ok)
+	}
+	return buf.Bytes()
+}
+
+// UpdateEnviron 更新环境变量, 若已协商 NEW_ENVIRON(或 OLD_ENVIRON) 则通过 INFO 通知服务端
+func (c *Client) UpdateEnviron(vars, userVars map[string]string) error {
+	var buf bytes.Buffer
+	buf.WriteByte(TELQUAL_INFO)
+	c.envMux.Lock()
+	for _, name := range sortedEnvironNames(vars) {
+		c.environ[name] = vars[name]
+		writeEnvironVar(&buf, ENV_VAR, name, vars[name], true)
+	}
+	for _, name := range sortedEnvironNames(userVars) {
+		c.userEnviron[name] = userVars[name]
+		writeEnvironVar(&buf, ENV_USERVAR, name, userVars[name], true)
+	}
+	c.envMux.Unlock()
+
+	var code byte
+	switch {
+	case c.LocalEnabled(NEW_ENVIRON):
+		code = NEW_ENVIRON
+	case c.LocalEnabled(OLD_ENVIRON):
+		code = OLD_ENVIRON
+	default:
+		return nil
+	}
+	return c.replyOptionPackets(OptionPacket{OptionCode: SB, CommandCode: code, Parameters: buf.Bytes()})
+}
+
+// parseEnvironVars 解析变量列表, SEND 请求中的变量没有值
+func parseEnvironVars(params []byte) []EnvironVar {
+	var (
+		vars    []EnvironVar
+		field   []byte
+		inValue bool
+		escaped bool
+	)
+	flush := func() {
+		if len(vars) == 0 {
+			return
+		}
+		if inValue {
+			vars[len(vars)-1].Value = string(field)
+		} else {
+			vars[len(vars)-1].Name = string(field)
+		}
+	}
+	for _, b := range params {
+		if escaped {
+			field = append(field, b)
+			escaped = false
+			continue
+		}
+		switch b {
+		case ENV_VAR, ENV_USERVAR:
+			flush()
+			vars = append(vars, EnvironVar{Type: b})
+			field = field[:0]
+			inValue = false
+		case ENV_VALUE:
+			flush()
+			if len(vars) > 0 {
+				vars[len(vars)-1].Defined = true
+			}
+			field = field[:0]
+			inValue = true
+		case ENV_ESC:
+			escaped = true
+		default:
+			field = append(field, b)
+		}
+	}
+	flush()
+	return vars
+}
+
+// writeEnvironVar 写入变量, defined 为 false 时只写变量名表示未定义
+func writeEnvironVar(buf *bytes.Buffer, kind byte, name, value string, defined bool) {
+	buf.WriteByte(kind)
+	writeEnvironEscaped(buf, name)
+	if defined {
+		buf.WriteByte(ENV_VALUE)
+		writeEnvironEscaped(buf, value)
+	}
+}
+
+func writeEnvironEscaped(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ENV_VAR, ENV_VALUE, ENV_ESC, ENV_USERVAR:
+			buf.WriteByte(ENV_ESC)
+		}
+		buf.WriteByte(s[i])
+	}
+}
+
+func sortedEnvironNames(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type environHandler struct {
+	code byte
+}
+
+func (environHandler) Accept(c *Client, local bool) bool {
+	return local && c.hasEnviron()
+}
+
+func (environHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (h environHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !sendRequest(c, h.code, params) {
+		return nil
+	}
+	return isReply(h.code, c.environReply(params[1:]))
+}
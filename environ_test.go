@@ -0,0 +1,130 @@
+package tclientlib
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironReply(t *testing.T) {
+	environ := map[string]string{"USER": "root", "LANG": "C", "ESC": "\x00\x01\x02\x03"}
+	userEnviron := map[string]string{"TZ": "UTC"}
+	tests := []struct {
+		name   string
+		params []byte
+		want   []byte
+	}{
+		{
+			name:   "empty list",
+			params: nil,
+			want: []byte{
+				ENV_VAR, 'E', 'S', 'C', ENV_VALUE, ENV_ESC, 0, ENV_ESC, 1, ENV_ESC, 2, ENV_ESC, 3,
+				ENV_VAR, 'L', 'A', 'N', 'G', ENV_VALUE, 'C',
+				ENV_VAR, 'U', 'S', 'E', 'R', ENV_VALUE, 'r', 'o', 'o', 't',
+				ENV_USERVAR, 'T', 'Z', ENV_VALUE, 'U', 'T', 'C',
+			},
+		},
+		{
+			name:   "all VAR",
+			params: []byte{ENV_VAR},
+			want: []byte{
+				ENV_VAR, 'E', 'S', 'C', ENV_VALUE, ENV_ESC, 0, ENV_ESC, 1, ENV_ESC, 2, ENV_ESC, 3,
+				ENV_VAR, 'L', 'A', 'N', 'G', ENV_VALUE, 'C',
+				ENV_VAR, 'U', 'S', 'E', 'R', ENV_VALUE, 'r', 'o', 'o', 't',
+			},
+		},
+		{
+			name:   "all USERVAR",
+			params: []byte{ENV_USERVAR},
+			want:   []byte{ENV_USERVAR, 'T', 'Z', ENV_VALUE, 'U', 'T', 'C'},
+		},
+		{
+			name:   "specific VAR",
+			params: []byte{ENV_VAR, 'U', 'S', 'E', 'R'},
+			want:   []byte{ENV_VAR, 'U', 'S', 'E', 'R', ENV_VALUE, 'r', 'o', 'o', 't'},
+		},
+		{
+			name:   "specific USERVAR",
+			params: []byte{ENV_USERVAR, 'T', 'Z'},
+			want:   []byte{ENV_USERVAR, 'T', 'Z', ENV_VALUE, 'U', 'T', 'C'},
+		},
+		{
+			name:   "undefined variable",
+			params: []byte{ENV_VAR, 'H', 'O', 'M', 'E', ENV_USERVAR, 'U', 'S', 'E', 'R'},
+			want:   []byte{ENV_VAR, 'H', 'O', 'M', 'E', ENV_USERVAR, 'U', 'S', 'E', 'R'},
+		},
+		{
+			name:   "escaped value",
+			params: []byte{ENV_VAR, 'E', 'S', 'C'},
+			want:   []byte{ENV_VAR, 'E', 'S', 'C', ENV_VALUE, ENV_ESC, 0, ENV_ESC, 1, ENV_ESC, 2, ENV_ESC, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{conf: &Config{Environ: environ, UserEnviron: userEnviron}}
+			c.initEnviron()
+			if got := c.environReply(tt.params); !bytes.Equal(got, tt.want) {
+				t.Errorf("environReply(%v) = %v, want %v", tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvironVars(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []byte
+		want   []EnvironVar
+	}{
+		{"empty", nil, nil},
+		{
+			name:   "names",
+			params: []byte{ENV_VAR, 'A', ENV_USERVAR, 'B', ENV_VAR},
+			want:   []EnvironVar{{Type: ENV_VAR, Name: "A"}, {Type: ENV_USERVAR, Name: "B"}, {Type: ENV_VAR}},
+		},
+		{
+			name:   "values",
+			params: []byte{ENV_VAR, 'A', ENV_VALUE, 'x', ENV_USERVAR, 'B', ENV_VALUE},
+			want: []EnvironVar{
+				{Type: ENV_VAR, Name: "A", Value: "x", Defined: true},
+				{Type: ENV_USERVAR, Name: "B", Defined: true},
+			},
+		},
+		{
+			name:   "escaped",
+			params: []byte{ENV_VAR, 'A', ENV_ESC, ENV_VALUE, ENV_VALUE, ENV_ESC, 0, ENV_ESC, ENV_ESC, ENV_ESC, ENV_USERVAR},
+			want:   []EnvironVar{{Type: ENV_VAR, Name: "A\x01", Value: "\x00\x02\x03", Defined: true}},
+		},
+		{
+			name:   "data before first variable",
+			params: []byte{'x', ENV_VAR, 'A'},
+			want:   []EnvironVar{{Type: ENV_VAR, Name: "A"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseEnvironVars(tt.params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvironVars(%v) = %+v, want %+v", tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEnvironEscaped(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []byte
+	}{
+		{"", nil},
+		{"abc", []byte("abc")},
+		{"\x00\x01\x02\x03\x04", []byte{ENV_ESC, 0, ENV_ESC, 1, ENV_ESC, 2, ENV_ESC, 3, 4}},
+		{"a\x02b", []byte{'a', ENV_ESC, 2, 'b'}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeEnvironEscaped(&buf, tt.s)
+		if !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("writeEnvironEscaped(%q) = %v, want %v", tt.s, buf.Bytes(), tt.want)
+		}
+	}
+}
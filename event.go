@@ -0,0 +1,60 @@
+package tclientlib
+
+import (
+	"fmt"
+)
+
+// Event 是服务端发来的协议事件, 具体类型为 CommandEvent、NegotiationEvent 或 SubnegotiationEvent
+type Event interface {
+	String() string
+}
+
+// EventHandler 在 Client.Read 的 goroutine 中同步调用, 不能在其中调用 Client.Read
+type EventHandler func(event Event)
+
+// CommandEvent 收到 IAC 命令, 如 IAC GA、IAC AYT
+type CommandEvent struct {
+	Command byte
+}
+
+func (e CommandEvent) String() string {
+	return fmt.Sprintf("command IAC %s", CodeTOASCII[e.Command])
+}
+
+// NegotiationEvent 选项状态发生变化, Local 为 true 时表示本端(client)的选项
+type NegotiationEvent struct {
+	Option  byte
+	Local   bool
+	Enabled bool
+}
+
+func (e NegotiationEvent) String() string {
+	side := "remote"
+	if e.Local {
+		side = "local"
+	}
+	return fmt.Sprintf("negotiation %s %s enabled: %v", side, CodeTOASCII[e.Option], e.Enabled)
+}
+
+// SubnegotiationEvent 收到子协商
+type SubnegotiationEvent struct {
+	Option     byte
+	Parameters []byte
+}
+
+func (e SubnegotiationEvent) String() string {
+	return fmt.Sprintf("subnegotiation %s %s", CodeTOASCII[e.Option],
+		ConvertSubOptions(e.Option, e.Parameters))
+}
+
+func WithEventHandler(handler EventHandler) Opt {
+	return func(client *Client) {
+		client.eventHandler = handler
+	}
+}
+
+func (c *Client) emitEvent(event Event) {
+	if c.eventHandler != nil {
+		c.eventHandler(event)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/LeeEirc/tclientlib
 
 go 1.15
+
+require golang.org/x/text v0.13.0
@@ -0,0 +1,129 @@
+package tclientlib
+
+// OptionHandler 处理单个选项的协商和子协商, 通过 WithOptionHandler 注册, 可以覆盖内置的处理。
+// 选项还需要在 Config.OptionPolicy 中允许才会启用, 见 WithOptionHandler。
+// 方法在 Client.Read 的 goroutine 中同步调用, 可以查询选项状态(如 Client.RemoteEnabled), 不能调用 Client.Read
+type OptionHandler interface {
+	// Accept 决定是否同意启用选项, local 为 true 时对应服务端的 DO, 否则对应服务端的 WILL
+	Accept(c *Client, local bool) bool
+	// Changed 在选项启用或关闭后调用, 返回需要额外发送的协议包
+	Changed(c *Client, local, enabled bool) []OptionPacket
+	// Subnegotiation 处理服务端的子协商, 返回需要回复的协议包, 选项未启用时不会调用
+	Subnegotiation(c *Client, params []byte) []OptionPacket
+}
+
+// WithOptionHandler 注册选项的处理, handler 为 nil 时移除该选项的处理(包括内置的处理)。
+// PermissiveOptionPolicy 允许注册了处理的选项, 是否启用由 handler.Accept 决定;
+// 使用其他 OptionPolicy 时需要把选项加入对应的列表
+func WithOptionHandler(code byte, handler OptionHandler) Opt {
+	return func(client *Client) {
+		if handler == nil {
+			delete(client.handlers, code)
+			delete(client.customHandlers, code)
+			return
+		}
+		client.handlers[code] = handler
+		client.customHandlers[code] = true
+	}
+}
+
+func defaultOptionHandlers() map[byte]OptionHandler {
+	return map[byte]OptionHandler{
+		BINARY:          binaryHandler{},
+		NAWS:            nawsHandler{},
+		TTYPE:           ttypeHandler{},
+		TSPEED:          tspeedHandler{},
+		XDISPLOC:        xdisplocHandler{},
+		OLD_ENVIRON:     environHandler{code: OLD_ENVIRON},
+		NEW_ENVIRON:     environHandler{code: NEW_ENVIRON},
+		LINEMODE:        linemodeHandler{},
+		LFLOW:           lflowHandler{},
+		STATUS:          statusHandler{},
+		CHARSET:         charsetHandler{},
+		START_TLS:       startTLSHandler{},
+		COM_PORT_OPTION: comPortHandler{},
+		EOR:             eorHandler{},
+	}
+}
+
+// sendRequest 判断是否为服务端对已启用的本端选项的 SEND 请求
+func sendRequest(c *Client, code byte, params []byte) bool {
+	return c.LocalEnabled(code) && len(params) > 0 && params[0] == TELQUAL_SEND
+}
+
+func isReply(code byte, value []byte) []OptionPacket {
+	params := append([]byte{TELQUAL_IS}, value...)
+	return []OptionPacket{{OptionCode: SB, CommandCode: code, Parameters: params}}
+}
+
+type nawsHandler struct{}
+
+func (nawsHandler) Accept(c *Client, local bool) bool {
+	return local
+}
+
+func (nawsHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	if local && enabled {
+		// 窗口大小
+		return []OptionPacket{nawsPacket(c.conf.TTYOptions.Wide, c.conf.TTYOptions.High)}
+	}
+	return nil
+}
+
+func (nawsHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	return nil
+}
+
+type ttypeHandler struct{}
+
+func (ttypeHandler) Accept(c *Client, local bool) bool {
+	return local
+}
+
+func (ttypeHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	if local {
+		c.ttypeIndex = 0
+	}
+	return nil
+}
+
+func (ttypeHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !sendRequest(c, TTYPE, params) {
+		return nil
+	}
+	return isReply(TTYPE, []byte(c.nextTermType()))
+}
+
+type tspeedHandler struct{}
+
+func (tspeedHandler) Accept(c *Client, local bool) bool {
+	return local && c.conf.TTYOptions.terminalSpeed() != ""
+}
+
+func (tspeedHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (tspeedHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !sendRequest(c, TSPEED, params) {
+		return nil
+	}
+	return isReply(TSPEED, []byte(c.conf.TTYOptions.terminalSpeed()))
+}
+
+type xdisplocHandler struct{}
+
+func (xdisplocHandler) Accept(c *Client, local bool) bool {
+	return local && c.conf.TTYOptions.XDisplayLocation != ""
+}
+
+func (xdisplocHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (xdisplocHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !sendRequest(c, XDISPLOC, params) {
+		return nil
+	}
+	return isReply(XDISPLOC, []byte(c.conf.TTYOptions.XDisplayLocation))
+}
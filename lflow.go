@@ -0,0 +1,85 @@
+package tclientlib
+
+import (
+	"sync"
+)
+
+// RFC 1372 LFLOW 子协商命令
+const (
+	LFLOW_OFF         = 0
+	LFLOW_ON          = 1
+	LFLOW_RESTART_ANY = 2
+	LFLOW_RESTART_XON = 3
+)
+
+// FlowControlState 是服务端要求的本地流控状态
+type FlowControlState struct {
+	// Enabled 为 true 时 ^S/^Q 由本地终端处理, 否则转发给服务端
+	Enabled bool
+	// RestartAny 为 true 时任意字符都可以恢复输出, 否则只有 XON(^Q)
+	RestartAny bool
+}
+
+type lflowState struct {
+	mux   sync.Mutex
+	state FlowControlState
+}
+
+// FlowControl 返回当前的流控状态, 未协商 LFLOW 时 ok 为 false
+func (c *Client) FlowControl() (state FlowControlState, ok bool) {
+	if !c.LocalEnabled(LFLOW) {
+		return state, false
+	}
+	c.lflow.mux.Lock()
+	defer c.lflow.mux.Unlock()
+	return c.lflow.state, true
+}
+
+func (c *Client) lflowChanged(enabled bool) {
+	c.lflow.mux.Lock()
+	defer c.lflow.mux.Unlock()
+	// 启用 LFLOW 后默认由本地处理流控, 只有 XON 可以恢复输出
+	c.lflow.state = FlowControlState{Enabled: enabled}
+}
+
+func (c *Client) handleLflow(params []byte) {
+	if len(params) == 0 {
+		return
+	}
+	c.lflow.mux.Lock()
+	defer c.lflow.mux.Unlock()
+	switch params[0] {
+	case LFLOW_OFF:
+		c.lflow.state.Enabled = false
+	case LFLOW_ON:
+		c.lflow.state.Enabled = true
+	case LFLOW_RESTART_ANY:
+		c.lflow.state.RestartAny = true
+	case LFLOW_RESTART_XON:
+		c.lflow.state.RestartAny = false
+	default:
+		traceLogf("[Telnet client] unknown lflow subnegotiation %v\r\n", params)
+		return
+	}
+	traceLogf("[Telnet client] flow control: %+v\r\n", c.lflow.state)
+}
+
+type lflowHandler struct{}
+
+func (lflowHandler) Accept(c *Client, local bool) bool {
+	return local
+}
+
+func (lflowHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	if local {
+		c.lflowChanged(enabled)
+	}
+	return nil
+}
+
+func (lflowHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if c.LocalEnabled(LFLOW) {
+		c.handleLflow(params)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package tclientlib
+
+import (
+	"bytes"
+	"sync"
+)
+
+// RFC 1184 LINEMODE 子协商命令
+const (
+	LM_MODE        = 1
+	LM_FORWARDMASK = 2
+	LM_SLC         = 3
+)
+
+// LINEMODE MODE 标志位
+const (
+	MODE_EDIT     = 0x01
+	MODE_TRAPSIG  = 0x02
+	MODE_ACK      = 0x04
+	MODE_SOFT_TAB = 0x08
+	MODE_LIT_ECHO = 0x10
+
+	MODE_MASK = 0x1f
+)
+
+// SLC 特殊字符功能
+const (
+	SLC_SYNCH = 1
+	SLC_BRK   = 2
+	SLC_IP    = 3
+	SLC_AO    = 4
+	SLC_AYT   = 5
+	SLC_EOR   = 6
+	SLC_ABORT = 7
+	SLC_EOF   = 8
+	SLC_SUSP  = 9
+	SLC_EC    = 10
+	SLC_EL    = 11
+	SLC_EW    = 12
+	SLC_RP    = 13
+	SLC_LNEXT = 14
+	SLC_XON   = 15
+	SLC_XOFF  = 16
+	SLC_FORW1 = 17
+	SLC_FORW2 = 18
+
+	NSLC = 18
+)
+
+// SLC 修饰符
+const (
+	SLC_NOSUPPORT  = 0
+	SLC_CANTCHANGE = 1
+	SLC_VALUE      = 2
+	SLC_DEFAULT    = 3
+	SLC_LEVELBITS  = 0x03
+
+	SLC_FLUSHOUT = 0x20
+	SLC_FLUSHIN  = 0x40
+	SLC_ACK      = 0x80
+)
+
+const slcDisabled = 0xff // _POSIX_VDISABLE
+
+// LinemodeMode 是当前生效的 LINEMODE MODE
+type LinemodeMode byte
+
+func (m LinemodeMode) Edit() bool {
+	return m&MODE_EDIT != 0
+}
+
+func (m LinemodeMode) TrapSig() bool {
+	return m&MODE_TRAPSIG != 0
+}
+
+func (m LinemodeMode) SoftTab() bool {
+	return m&MODE_SOFT_TAB != 0
+}
+
+func (m LinemodeMode) LitEcho() bool {
+	return m&MODE_LIT_ECHO != 0
+}
+
+type slcEntry struct {
+	flags byte
+	value byte
+}
+
+func (e slcEntry) level() byte {
+	return e.flags & SLC_LEVELBITS
+}
+
+// 本端默认的特殊字符
+var defaultSLC = [NSLC + 1]slcEntry{
+	SLC_IP:    {flags: SLC_VALUE | SLC_FLUSHIN | SLC_FLUSHOUT, value: 0x03},
+	SLC_AO:    {flags: SLC_VALUE | SLC_FLUSHOUT, value: 0x0f},
+	SLC_AYT:   {flags: SLC_VALUE, value: 0x14},
+	SLC_ABORT: {flags: SLC_VALUE | SLC_FLUSHIN | SLC_FLUSHOUT, value: 0x1c},
+	SLC_EOF:   {flags: SLC_VALUE, value: 0x04},
+	SLC_SUSP:  {flags: SLC_VALUE | SLC_FLUSHIN, value: 0x1a},
+	SLC_EC:    {flags: SLC_VALUE, value: 0x7f},
+	SLC_EL:    {flags: SLC_VALUE, value: 0x15},
+	SLC_EW:    {flags: SLC_VALUE, value: 0x17},
+	SLC_RP:    {flags: SLC_VALUE, value: 0x12},
+	SLC_LNEXT: {flags: SLC_VALUE, value: 0x16},
+	SLC_XON:   {flags: SLC_VALUE, value: 0x11},
+	SLC_XOFF:  {flags: SLC_VALUE, value: 0x13},
+}
+
+// TRAPSIG 模式下特殊字符对应的 telnet 命令
+var slcCommands = map[byte]byte{
+	SLC_BRK:   BRK,
+	SLC_IP:    IP,
+	SLC_AO:    AO,
+	SLC_AYT:   AYT,
+	SLC_ABORT: ABORT,
+	SLC_SUSP:  SUSP,
+}
+
+type linemodeState struct {
+	mux         sync.Mutex
+	mode        LinemodeMode
+	slc         [NSLC + 1]slcEntry
+	forwardMask []byte
+	line        []byte
+	literalNext bool
+}
+
+func (l *linemodeState) reset() {
+	l.mode = 0
+	l.slc = defaultSLC
+	l.forwardMask = nil
+	l.line = nil
+	l.literalNext = false
+}
+
+// slcTable 返回本端完整的 SLC 三元组
+func (l *linemodeState) slcTable() []byte {
+	params := []byte{LM_SLC}
+	for i := 1; i <= NSLC; i++ {
+		entry := l.slc[i]
+		if entry.level() == SLC_NOSUPPORT {
+			params = append(params, byte(i), SLC_NOSUPPORT, 0)
+			continue
+		}
+		params = append(params, byte(i), entry.flags, entry.value)
+	}
+	return params
+}
+
+// LinemodeMode 返回当前的 LINEMODE 模式, 未协商 LINEMODE 时 ok 为 false
+func (c *Client) LinemodeMode() (mode LinemodeMode, ok bool) {
+	if !c.LocalEnabled(LINEMODE) {
+		return 0, false
+	}
+	c.linemode.mux.Lock()
+	defer c.linemode.mux.Unlock()
+	return c.linemode.mode, true
+}
+
+func (c *Client) linemodeChanged(enabled bool) []OptionPacket {
+	c.linemode.mux.Lock()
+	defer c.linemode.mux.Unlock()
+	c.linemode.reset()
+	if !enabled {
+		return nil
+	}
+	return []OptionPacket{linemodePacket(c.linemode.slcTable())}
+}
+
+func (c *Client) handleLinemode(params []byte) []OptionPacket {
+	if len(params) == 0 {
+		return nil
+	}
+	c.linemode.mux.Lock()
+	defer c.linemode.mux.Unlock()
+	switch params[0] {
+	case LM_MODE:
+		if len(params) < 2 {
+			return nil
+		}
+		return c.handleLinemodeMode(params[1])
+	case LM_SLC:
+		return c.handleSLC(params[1:])
+	case DO, DONT:
+		if len(params) < 2 || params[1] != LM_FORWARDMASK {
+			return nil
+		}
+		if params[0] == DONT {
+			c.linemode.forwardMask = nil
+			return []OptionPacket{linemodePacket([]byte{WONT, LM_FORWARDMASK})}
+		}
+		c.linemode.forwardMask = append([]byte(nil), params[2:]...)
+		return []OptionPacket{linemodePacket([]byte{WILL, LM_FORWARDMASK})}
+	case WILL, WONT:
+		// 服务端对 FORWARDMASK 的回应, client 不会发送 DO FORWARDMASK
+		return nil
+	}
+	traceLogf("[Telnet client] unknown linemode subnegotiation %v\r\n", params)
+	return nil
+}
+
+func (c *Client) handleLinemodeMode(mask byte) []OptionPacket {
+	newMode := LinemodeMode(mask & MODE_MASK &^ MODE_ACK)
+	if mask&MODE_ACK != 0 || newMode == c.linemode.mode {
+		// 与当前模式相同时不需要回复, 带 MODE_ACK 而与当前模式不同时按 RFC 1184 忽略
+		return nil
+	}
+	c.setLinemodeMode(newMode)
+	return []OptionPacket{linemodePacket([]byte{LM_MODE, byte(newMode) | MODE_ACK})}
+}
+
+func (c *Client) setLinemodeMode(mode LinemodeMode) {
+	if c.linemode.mode.Edit() && !mode.Edit() {
+		c.linemode.line = nil
+		c.linemode.literalNext = false
+	}
+	c.linemode.mode = mode
+	traceLogf("[Telnet client] linemode mode: %#x\r\n", byte(mode))
+}
+
+// handleSLC 处理服务端的 SLC 三元组, 接受服务端的设置并回复确认
+func (c *Client) handleSLC(params []byte) []OptionPacket {
+	var reply []byte
+	for i := 0; i+2 < len(params); i += 3 {
+		function, flags, value := params[i], params[i+1], params[i+2]
+		if function == 0 {
+			switch flags & SLC_LEVELBITS {
+			case SLC_DEFAULT:
+				c.linemode.slc = defaultSLC
+				fallthrough
+			case SLC_VALUE:
+				return []OptionPacket{linemodePacket(c.linemode.slcTable())}
+			}
+			continue
+		}
+		if function > NSLC {
+			reply = append(reply, function, SLC_NOSUPPORT, 0)
+			continue
+		}
+		current := &c.linemode.slc[function]
+		if flags&SLC_ACK != 0 {
+			current.flags = flags &^ SLC_ACK
+			current.value = value
+			continue
+		}
+		if current.flags == flags && current.value == value {
+			continue
+		}
+		switch flags & SLC_LEVELBITS {
+		case SLC_DEFAULT:
+			*current = defaultSLC[function]
+			reply = append(reply, function, current.flags, current.value)
+		case SLC_NOSUPPORT:
+			*current = slcEntry{flags: SLC_NOSUPPORT}
+			reply = append(reply, function, SLC_NOSUPPORT|SLC_ACK, 0)
+		default:
+			*current = slcEntry{flags: flags, value: value}
+			reply = append(reply, function, flags|SLC_ACK, value)
+		}
+	}
+	if len(reply) == 0 {
+		return nil
+	}
+	return []OptionPacket{linemodePacket(append([]byte{LM_SLC}, reply...))}
+}
+
+func linemodePacket(params []byte) OptionPacket {
+	return OptionPacket{OptionCode: SB, CommandCode: LINEMODE, Parameters: params}
+}
+
+// linemodeEncode 按当前模式处理用户输入, EDIT 模式下本地编辑并按行发送,
+// TRAPSIG 模式下将信号字符转换为 telnet 命令。返回值可以直接写入连接
+func (c *Client) linemodeEncode(p []byte) []byte {
+	c.linemode.mux.Lock()
+	defer c.linemode.mux.Unlock()
+	l := &c.linemode
+	var out bytes.Buffer
+	for _, b := range p {
+		if l.literalNext {
+			l.literalNext = false
+			l.line = append(l.line, b)
+			continue
+		}
+		function := l.slcFunction(b)
+		if l.mode.TrapSig() {
+			if cmd, ok := slcCommands[function]; ok {
+				if l.slc[function].flags&SLC_FLUSHIN != 0 {
+					l.line = nil
+				}
+				out.Write([]byte{IAC, cmd})
+				continue
+			}
+		}
+		if !l.mode.Edit() {
+			out.Write(escapeIAC([]byte{b}))
+			continue
+		}
+		switch function {
+		case SLC_EC:
+			if len(l.line) > 0 {
+				l.line = l.line[:len(l.line)-1]
+			}
+			continue
+		case SLC_EL:
+			l.line = l.line[:0]
+			continue
+		case SLC_EW:
+			l.line = eraseWord(l.line)
+			continue
+		case SLC_LNEXT:
+			l.literalNext = true
+			continue
+		case SLC_EOF:
+			out.Write(escapeIAC(l.line))
+			out.Write([]byte{IAC, XEOF})
+			l.line = l.line[:0]
+			continue
+		}
+		l.line = append(l.line, b)
+		if b == '\r' || b == '\n' || function == SLC_FORW1 || function == SLC_FORW2 || l.forwardChar(b) {
+			out.Write(escapeIAC(l.line))
+			l.line = l.line[:0]
+		}
+	}
+	return out.Bytes()
+}
+
+// slcFunction 返回字符对应的 SLC 功能, 没有对应功能时返回 0
+func (l *linemodeState) slcFunction(b byte) byte {
+	if b == slcDisabled {
+		return 0
+	}
+	for i := 1; i <= NSLC; i++ {
+		if l.slc[i].level() != SLC_NOSUPPORT && l.slc[i].value == b {
+			return byte(i)
+		}
+	}
+	return 0
+}
+
+// forwardChar 判断字符是否在 FORWARDMASK 中, 第一个字节的最高位对应字符 0
+func (l *linemodeState) forwardChar(b byte) bool {
+	index := int(b) / 8
+	if index >= len(l.forwardMask) {
+		return false
+	}
+	return l.forwardMask[index]&(0x80>>(b%8)) != 0
+}
+
+func eraseWord(line []byte) []byte {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		end--
+	}
+	for end > 0 && line[end-1] != ' ' {
+		end--
+	}
+	return line[:end]
+}
+
+type linemodeHandler struct{}
+
+func (linemodeHandler) Accept(c *Client, local bool) bool {
+	return local && c.conf.Linemode
+}
+
+func (linemodeHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	if !local {
+		return nil
+	}
+	return c.linemodeChanged(enabled)
+}
+
+func (linemodeHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !c.LocalEnabled(LINEMODE) {
+		return nil
+	}
+	return c.handleLinemode(params)
+}
@@ -0,0 +1,55 @@
+package tclientlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandleLinemodeMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  LinemodeMode
+		mask     byte
+		wantMode LinemodeMode
+		want     []OptionPacket
+	}{
+		{
+			name:     "new mode",
+			current:  0,
+			mask:     MODE_EDIT,
+			wantMode: MODE_EDIT,
+			want:     []OptionPacket{linemodePacket([]byte{LM_MODE, MODE_EDIT | MODE_ACK})},
+		},
+		{
+			name:     "same mode",
+			current:  MODE_EDIT,
+			mask:     MODE_EDIT,
+			wantMode: MODE_EDIT,
+		},
+		{
+			name:     "ack of current mode",
+			current:  MODE_EDIT,
+			mask:     MODE_EDIT | MODE_ACK,
+			wantMode: MODE_EDIT,
+		},
+		{
+			name:     "ack of different mode ignored",
+			current:  MODE_EDIT,
+			mask:     MODE_TRAPSIG | MODE_ACK,
+			wantMode: MODE_EDIT,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			c.linemode.mode = tt.current
+			got := c.handleLinemodeMode(tt.mask)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("handleLinemodeMode(%#x) = %v, want %v", tt.mask, got, tt.want)
+			}
+			if c.linemode.mode != tt.wantMode {
+				t.Errorf("mode = %#x, want %#x", byte(c.linemode.mode), byte(tt.wantMode))
+			}
+		})
+	}
+}
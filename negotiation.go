@@ -0,0 +1,414 @@
+package tclientlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrOptionAlreadyEnabled  = errors.New("option already enabled")
+	ErrOptionAlreadyDisabled = errors.New("option already disabled")
+	ErrOptionNegotiating     = errors.New("option already negotiating")
+	ErrOptionQueued          = errors.New("option negotiation already queued")
+	ErrOptionRefused         = errors.New("option refused")
+)
+
+// RFC 1143 Q Method 选项协商状态
+type qState int
+
+const (
+	qNo qState = iota
+	qYes
+	qWantNo
+	qWantYes
+)
+
+var qStateTOASCII = map[qState]string{
+	qNo:      "NO",
+	qYes:     "YES",
+	qWantNo:  "WANTNO",
+	qWantYes: "WANTYES",
+}
+
+func (s qState) String() string {
+	return qStateTOASCII[s]
+}
+
+// optionSide 记录一端(us 或 him)的选项状态, opposite 为 RFC 1143 中的队列位
+type optionSide struct {
+	state    qState
+	opposite bool
+}
+
+func (s *optionSide) enabled() bool {
+	return s.state == qYes
+}
+
+func (s *optionSide) settled() bool {
+	return s.state == qYes || s.state == qNo
+}
+
+// receiveEnable 处理对端的 WILL(him) 或 DO(us)
+// send 表示是否需要回复, positive 为 true 时回复 DO/WILL, 否则回复 DONT/WONT
+func (s *optionSide) receiveEnable(accept bool) (send, positive bool) {
+	switch s.state {
+	case qNo:
+		if accept {
+			s.state = qYes
+			return true, true
+		}
+		return true, false
+	case qWantNo:
+		if s.opposite {
+			s.state = qYes
+			s.opposite = false
+			return false, false
+		}
+		// DONT/WONT 被 WILL/DO 回应, 对端违反协议
+		s.state = qNo
+	case qWantYes:
+		if s.opposite {
+			s.state = qWantNo
+			s.opposite = false
+			return true, false
+		}
+		s.state = qYes
+	}
+	return false, false
+}
+
+// receiveDisable 处理对端的 WONT(him) 或 DONT(us)
+func (s *optionSide) receiveDisable() (send, positive bool) {
+	switch s.state {
+	case qYes:
+		s.state = qNo
+		return true, false
+	case qWantNo:
+		if s.opposite {
+			s.state = qWantYes
+			s.opposite = false
+			return true, true
+		}
+		s.state = qNo
+	case qWantYes:
+		s.state = qNo
+		s.opposite = false
+	}
+	return false, false
+}
+
+// request 由本端主动发起启用或关闭选项, send 表示是否需要发送 WILL/DO 或 WONT/DONT
+func (s *optionSide) request(enable bool) (send bool, err error) {
+	if enable {
+		switch s.state {
+		case qNo:
+			s.state = qWantYes
+			return true, nil
+		case qYes:
+			return false, ErrOptionAlreadyEnabled
+		case qWantNo:
+			if s.opposite {
+				return false, ErrOptionQueued
+			}
+			s.opposite = true
+		case qWantYes:
+			if !s.opposite {
+				return false, ErrOptionNegotiating
+			}
+			s.opposite = false
+		}
+		return false, nil
+	}
+	switch s.state {
+	case qNo:
+		return false, ErrOptionAlreadyDisabled
+	case qYes:
+		s.state = qWantNo
+		return true, nil
+	case qWantNo:
+		if !s.opposite {
+			return false, ErrOptionNegotiating
+		}
+		s.opposite = false
+	case qWantYes:
+		if s.opposite {
+			return false, ErrOptionQueued
+		}
+		s.opposite = true
+	}
+	return false, nil
+}
+
+type optionKey struct {
+	code  byte
+	local bool
+}
+
+type optionState struct {
+	us  optionSide // 本端(client)
+	him optionSide // 对端(server)
+}
+
+// negotiate 按 Q Method 处理 WILL/WONT/DO/DONT, 只有状态变化时才回复
+func (c *Client) negotiate(p OptionPacket) []OptionPacket {
+	var (
+		side             *optionSide
+		send             bool
+		positive         bool
+		accept           bool
+		posVerb, negVerb byte
+		local            = p.OptionCode == DO || p.OptionCode == DONT
+	)
+	if p.OptionCode == DO || p.OptionCode == WILL {
+		// 在持有 optMux 之前调用, OptionHandler.Accept 中可以查询选项状态
+		accept = c.acceptOption(p.CommandCode, local)
+	}
+	c.optMux.Lock()
+	opt := &c.options[p.CommandCode]
+	if local {
+		side, posVerb, negVerb = &opt.us, WILL, WONT
+	} else {
+		side, posVerb, negVerb = &opt.him, DO, DONT
+	}
+	wasEnabled := side.enabled()
+	switch p.OptionCode {
+	case DO, WILL:
+		send, positive = side.receiveEnable(accept)
+	case DONT, WONT:
+		send, positive = side.receiveDisable()
+	}
+	isEnabled := side.enabled()
+	settled := side.settled()
+	c.optMux.Unlock()
+
+	var replies []OptionPacket
+	if send {
+		reply := OptionPacket{OptionCode: negVerb, CommandCode: p.CommandCode}
+		if positive {
+			reply.OptionCode = posVerb
+		}
+		replies = append(replies, reply)
+	}
+	if wasEnabled != isEnabled {
+		traceLogf("[Telnet client] option %s local(%v) enabled: %v\r\n",
+			CodeTOASCII[p.CommandCode], local, isEnabled)
+		c.emitEvent(NegotiationEvent{Option: p.CommandCode, Local: local, Enabled: isEnabled})
+		if c.optionChangeHandler != nil {
+			c.optionChangeHandler(OptionState{
+				Option: p.CommandCode,
+				Local:  c.LocalEnabled(p.CommandCode),
+				Remote: c.RemoteEnabled(p.CommandCode),
+			})
+		}
+		replies = append(replies, c.optionChanged(p.CommandCode, local, isEnabled)...)
+	}
+	if settled {
+		c.notifyOption(optionKey{code: p.CommandCode, local: local}, isEnabled)
+	}
+	return replies
+}
+
+// requestOption 主动请求本端(local)或对端启用/关闭选项
+func (c *Client) requestOption(code byte, local, enable bool) error {
+	var verb byte = DONT
+	if enable {
+		verb = DO
+	}
+	c.optMux.Lock()
+	side := &c.options[code].him
+	if local {
+		side, verb = &c.options[code].us, WONT
+		if enable {
+			verb = WILL
+		}
+	}
+	send, err := side.request(enable)
+	c.optMux.Unlock()
+	if err != nil || !send {
+		return err
+	}
+	packet := OptionPacket{OptionCode: verb, CommandCode: code}
+	traceLogf("[Telnet client] client: %s\r\n", packet)
+	return c.replyOptionPackets(packet)
+}
+
+// requestInitialOptions 在登录前主动请求启用 Config.RequestLocal 和 Config.RequestRemote 中的选项,
+// 服务端的回应由 Client.Read 处理。本端不会同意启用的选项会被跳过
+func (c *Client) requestInitialOptions() error {
+	for _, code := range c.conf.RequestLocal {
+		if err := c.requestInitialOption(code, true); err != nil {
+			return err
+		}
+	}
+	for _, code := range c.conf.RequestRemote {
+		if err := c.requestInitialOption(code, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) requestInitialOption(code byte, local bool) error {
+	if !c.acceptOption(code, local) {
+		c.LogF("[Telnet client] skip requesting option %s local(%v)", CodeTOASCII[code], local)
+		return nil
+	}
+	switch err := c.requestOption(code, local, true); err {
+	case nil, ErrOptionAlreadyEnabled, ErrOptionNegotiating, ErrOptionQueued:
+		return nil
+	default:
+		return err
+	}
+}
+
+// enableOption 请求启用选项并等待协商结果, 协商结果由 Client.Read 处理
+func (c *Client) enableOption(ctx context.Context, code byte, local bool) error {
+	return c.switchOption(ctx, code, local, true)
+}
+
+// switchOption 请求启用或关闭选项并等待协商结果, 协商结果由 Client.Read 处理,
+// Config.OptionPolicy 不允许的选项不发送请求, 直接返回 ErrOptionRefused
+func (c *Client) switchOption(ctx context.Context, code byte, local, enable bool) error {
+	if enable && !c.policyAllows(code, local) {
+		traceLogf("[Telnet client] request option %s local(%v) refused by policy\r\n", CodeTOASCII[code], local)
+		return ErrOptionRefused
+	}
+	return c.waitSwitchOption(ctx, code, local, enable)
+}
+
+// waitSwitchOption 同 switchOption, 但不检查 Config.OptionPolicy
+func (c *Client) waitSwitchOption(ctx context.Context, code byte, local, enable bool) error {
+	key := optionKey{code: code, local: local}
+	settled := c.waitOption(key)
+	defer c.cancelWaitOption(key, settled)
+	switch err := c.requestOption(code, local, enable); err {
+	case nil, ErrOptionNegotiating, ErrOptionQueued:
+	case ErrOptionAlreadyEnabled, ErrOptionAlreadyDisabled:
+		return nil
+	default:
+		return err
+	}
+	select {
+	case enabled := <-settled:
+		if enabled != enable {
+			return ErrOptionRefused
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) waitOption(key optionKey) chan bool {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	ch := make(chan bool, 1)
+	if c.optionWaiters == nil {
+		c.optionWaiters = make(map[optionKey][]chan bool)
+	}
+	c.optionWaiters[key] = append(c.optionWaiters[key], ch)
+	return ch
+}
+
+func (c *Client) cancelWaitOption(key optionKey, ch chan bool) {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	waiters := c.optionWaiters[key]
+	for i := range waiters {
+		if waiters[i] == ch {
+			c.optionWaiters[key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *Client) notifyOption(key optionKey, enabled bool) {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	for _, ch := range c.optionWaiters[key] {
+		ch <- enabled
+	}
+	delete(c.optionWaiters, key)
+}
+
+// LocalEnabled 返回本端(client)的选项是否已启用, 如 NAWS、TTYPE
+func (c *Client) LocalEnabled(code byte) bool {
+	c.optMux.Lock()
+	defer c.optMux.Unlock()
+	return c.options[code].us.enabled()
+}
+
+// RemoteEnabled 返回服务端的选项是否已启用, 如 ECHO 表示服务端回显, SGA 表示不使用 GA
+func (c *Client) RemoteEnabled(code byte) bool {
+	c.optMux.Lock()
+	defer c.optMux.Unlock()
+	return c.options[code].him.enabled()
+}
+
+// OptionState 是单个选项在两端的启用状态
+type OptionState struct {
+	Option byte
+	Local  bool
+	Remote bool
+}
+
+func (s OptionState) String() string {
+	return fmt.Sprintf("%s local: %v remote: %v", CodeTOASCII[s.Option], s.Local, s.Remote)
+}
+
+// Options 返回至少一端已启用的选项的状态快照, 按选项编号排序
+func (c *Client) Options() []OptionState {
+	c.optMux.Lock()
+	defer c.optMux.Unlock()
+	var states []OptionState
+	for code := range c.options {
+		state := OptionState{
+			Option: byte(code),
+			Local:  c.options[code].us.enabled(),
+			Remote: c.options[code].him.enabled(),
+		}
+		if state.Local || state.Remote {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// OptionChangeHandler 在选项启用或关闭后调用, 参数为该选项变化后的状态。
+// 在 Client.Read 的 goroutine 中同步调用, 不能在其中调用 Client.Read
+type OptionChangeHandler func(state OptionState)
+
+func WithOptionChangeHandler(handler OptionChangeHandler) Opt {
+	return func(client *Client) {
+		client.optionChangeHandler = handler
+	}
+}
+
+// acceptOption 决定是否同意服务端的 DO(local) 或 WILL, 选项需要在 Config.OptionPolicy 中
+// (PermissiveOptionPolicy 下也可以是 WithOptionHandler 注册的选项),
+// 并由选项的 OptionHandler 同意, 没有 OptionHandler 的选项只同意服务端的 WILL
+func (c *Client) acceptOption(code byte, local bool) bool {
+	if !c.policyAllows(code, local) {
+		traceLogf("[Telnet client] option %s local(%v) refused by policy\r\n", CodeTOASCII[code], local)
+		return false
+	}
+	if handler, ok := c.handlers[code]; ok {
+		return handler.Accept(c, local)
+	}
+	return !local
+}
+
+// policyAllows 报告 Config.OptionPolicy 是否允许启用选项
+func (c *Client) policyAllows(code byte, local bool) bool {
+	policy := c.conf.OptionPolicy
+	return policy.allowed(code, local) || (policy.custom && c.customHandlers[code])
+}
+
+// optionChanged 在选项启用或关闭后返回需要额外发送的协议包
+func (c *Client) optionChanged(code byte, local, enabled bool) []OptionPacket {
+	if handler, ok := c.handlers[code]; ok {
+		return handler.Changed(c, local, enabled)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package tclientlib
+
+import (
+	"testing"
+)
+
+func TestOptionSideReceiveEnable(t *testing.T) {
+	tests := []struct {
+		name           string
+		from           optionSide
+		accept         bool
+		want           optionSide
+		send, positive bool
+	}{
+		{"no accept", optionSide{state: qNo}, true, optionSide{state: qYes}, true, true},
+		{"no refuse", optionSide{state: qNo}, false, optionSide{state: qNo}, true, false},
+		{"yes", optionSide{state: qYes}, true, optionSide{state: qYes}, false, false},
+		{"wantno", optionSide{state: qWantNo}, true, optionSide{state: qNo}, false, false},
+		{"wantno opposite", optionSide{state: qWantNo, opposite: true}, true, optionSide{state: qYes}, false, false},
+		{"wantyes", optionSide{state: qWantYes}, false, optionSide{state: qYes}, false, false},
+		{"wantyes opposite", optionSide{state: qWantYes, opposite: true}, true, optionSide{state: qWantNo}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.from
+			send, positive := s.receiveEnable(tt.accept)
+			if s != tt.want || send != tt.send || positive != tt.positive {
+				t.Errorf("receiveEnable() = %+v, %v, %v, want %+v, %v, %v",
+					s, send, positive, tt.want, tt.send, tt.positive)
+			}
+		})
+	}
+}
+
+func TestOptionSideReceiveDisable(t *testing.T) {
+	tests := []struct {
+		name           string
+		from           optionSide
+		want           optionSide
+		send, positive bool
+	}{
+		{"no", optionSide{state: qNo}, optionSide{state: qNo}, false, false},
+		{"yes", optionSide{state: qYes}, optionSide{state: qNo}, true, false},
+		{"wantno", optionSide{state: qWantNo}, optionSide{state: qNo}, false, false},
+		{"wantno opposite", optionSide{state: qWantNo, opposite: true}, optionSide{state: qWantYes}, true, true},
+		{"wantyes", optionSide{state: qWantYes}, optionSide{state: qNo}, false, false},
+		{"wantyes opposite", optionSide{state: qWantYes, opposite: true}, optionSide{state: qNo}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.from
+			send, positive := s.receiveDisable()
+			if s != tt.want || send != tt.send || positive != tt.positive {
+				t.Errorf("receiveDisable() = %+v, %v, %v, want %+v, %v, %v",
+					s, send, positive, tt.want, tt.send, tt.positive)
+			}
+		})
+	}
+}
+
+func TestOptionSideRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   optionSide
+		enable bool
+		want   optionSide
+		send   bool
+		err    error
+	}{
+		{"enable no", optionSide{state: qNo}, true, optionSide{state: qWantYes}, true, nil},
+		{"enable yes", optionSide{state: qYes}, true, optionSide{state: qYes}, false, ErrOptionAlreadyEnabled},
+		{"enable wantno", optionSide{state: qWantNo}, true, optionSide{state: qWantNo, opposite: true}, false, nil},
+		{"enable wantno opposite", optionSide{state: qWantNo, opposite: true}, true, optionSide{state: qWantNo, opposite: true}, false, ErrOptionQueued},
+		{"enable wantyes", optionSide{state: qWantYes}, true, optionSide{state: qWantYes}, false, ErrOptionNegotiating},
+		{"enable wantyes opposite", optionSide{state: qWantYes, opposite: true}, true, optionSide{state: qWantYes}, false, nil},
+		{"disable no", optionSide{state: qNo}, false, optionSide{state: qNo}, false, ErrOptionAlreadyDisabled},
+		{"disable yes", optionSide{state: qYes}, false, optionSide{state: qWantNo}, true, nil},
+		{"disable wantno", optionSide{state: qWantNo}, false, optionSide{state: qWantNo}, false, ErrOptionNegotiating},
+		{"disable wantno opposite", optionSide{state: qWantNo, opposite: true}, false, optionSide{state: qWantNo}, false, nil},
+		{"disable wantyes", optionSide{state: qWantYes}, false, optionSide{state: qWantYes, opposite: true}, false, nil},
+		{"disable wantyes opposite", optionSide{state: qWantYes, opposite: true}, false, optionSide{state: qWantYes, opposite: true}, false, ErrOptionQueued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.from
+			send, err := s.request(tt.enable)
+			if s != tt.want || send != tt.send || err != tt.err {
+				t.Errorf("request(%v) = %+v, %v, %v, want %+v, %v, %v",
+					tt.enable, s, send, err, tt.want, tt.send, tt.err)
+			}
+		})
+	}
+}
+
+func TestOptionSideRoundTrip(t *testing.T) {
+	// 本端请求启用, 在收到回复前又请求关闭, 对端同意启用后应继续发送关闭请求
+	var s optionSide
+	steps := []struct {
+		name string
+		do   func() (bool, bool)
+		send bool
+		want optionSide
+	}{
+		{"request enable", func() (bool, bool) { send, _ := s.request(true); return send, false }, true, optionSide{state: qWantYes}},
+		{"request disable", func() (bool, bool) { send, _ := s.request(false); return send, false }, false, optionSide{state: qWantYes, opposite: true}},
+		{"receive enable", func() (bool, bool) { return s.receiveEnable(true) }, true, optionSide{state: qWantNo}},
+		{"receive disable", func() (bool, bool) { return s.receiveDisable() }, false, optionSide{state: qNo}},
+	}
+	for _, step := range steps {
+		send, _ := step.do()
+		if send != step.send || s != step.want {
+			t.Fatalf("%s: state %+v send %v, want %+v send %v", step.name, s, send, step.want, step.send)
+		}
+	}
+	if !s.settled() || s.enabled() {
+		t.Errorf("state %+v should be settled and disabled", s)
+	}
+}
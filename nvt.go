@@ -0,0 +1,160 @@
+package tclientlib
+
+import (
+	"bytes"
+	"sync"
+)
+
+// EOLPolicy 决定非 BINARY 模式下 Client.Read/Client.Write 对行结束符(RFC 854)的转换。
+// 使用 EOLCRLF 或 EOLCRNUL 时, 收到的 CR LF 转换为 \n, CR NUL 转换为 \r,
+// 数据末尾的 CR 会保留到下一次读取时再处理
+type EOLPolicy int
+
+const (
+	// EOLRaw 不转换行结束符, 只将收到的 CR NUL 还原为 CR, 发送时在没有跟随 LF 的 CR 后补充 NUL
+	EOLRaw EOLPolicy = iota
+	// EOLCRLF 发送时将 \r、\n 和 \r\n 都转换为 CR LF
+	EOLCRLF
+	// EOLCRNUL 发送时将 \r、\n 和 \r\n 都转换为 CR NUL
+	EOLCRNUL
+)
+
+func (p EOLPolicy) translate() bool {
+	return p == EOLCRLF || p == EOLCRNUL
+}
+
+func (p EOLPolicy) sequence() []byte {
+	if p == EOLCRLF {
+		return []byte{'\r', '\n'}
+	}
+	return []byte{'\r', 0}
+}
+
+type nvtState struct {
+	mux     sync.Mutex
+	readCR  bool // 上一次读取的数据以 CR 结尾
+	writeCR bool // 上一次发送的数据以 CR 结尾
+	raw     bool // 由 Client.SetBinary 开启, BINARY 下不做字符集转换
+}
+
+func (s *nvtState) setRaw(raw bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.raw = raw
+}
+
+func (s *nvtState) rawTransfer() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.raw
+}
+
+// decode 按 NVT 规则处理收到的 CR NUL 和 CR LF
+func (s *nvtState) decode(p []byte, policy EOLPolicy) []byte {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(p) == 0 {
+		return p
+	}
+	translate := policy.translate()
+	if !s.readCR && bytes.IndexByte(p, '\r') < 0 {
+		return p
+	}
+	out := make([]byte, 0, len(p)+1)
+	i := 0
+	if s.readCR {
+		s.readCR = false
+		switch {
+		case p[0] == 0:
+			i++
+			if translate {
+				out = append(out, '\r')
+			}
+		case p[0] == '\n' && translate:
+			i++
+			out = append(out, '\n')
+		case translate:
+			out = append(out, '\r')
+		}
+	}
+	for ; i < len(p); i++ {
+		if p[i] != '\r' {
+			out = append(out, p[i])
+			continue
+		}
+		if i+1 == len(p) {
+			s.readCR = true
+			if !translate {
+				out = append(out, '\r')
+			}
+			continue
+		}
+		switch {
+		case p[i+1] == 0:
+			out = append(out, '\r')
+			i++
+		case p[i+1] == '\n' && translate:
+			out = append(out, '\n')
+			i++
+		default:
+			out = append(out, '\r')
+		}
+	}
+	return out
+}
+
+// encode 按 NVT 规则转换发送数据中的行结束符
+func (s *nvtState) encode(p []byte, policy EOLPolicy) []byte {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(p) == 0 {
+		return p
+	}
+	writeCR := s.writeCR
+	s.writeCR = p[len(p)-1] == '\r'
+	if !policy.translate() {
+		return nvtEncode(p)
+	}
+	if bytes.IndexByte(p, '\r') < 0 && bytes.IndexByte(p, '\n') < 0 {
+		return p
+	}
+	eol := policy.sequence()
+	out := make([]byte, 0, len(p)+2)
+	for i, b := range p {
+		switch b {
+		case '\r':
+			out = append(out, eol...)
+		case '\n':
+			// \r\n 只发送一次行结束符
+			if (i == 0 && writeCR) || (i > 0 && p[i-1] == '\r') {
+				continue
+			}
+			out = append(out, eol...)
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (s *nvtState) reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.readCR = false
+	s.writeCR = false
+}
+
+// nvtEncode 在没有跟随 LF 的 CR 后补充 NUL
+func nvtEncode(p []byte) []byte {
+	if bytes.IndexByte(p, '\r') < 0 {
+		return p
+	}
+	out := make([]byte, 0, len(p)+1)
+	for i := 0; i < len(p); i++ {
+		out = append(out, p[i])
+		if p[i] == '\r' && (i+1 == len(p) || p[i+1] != '\n') {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
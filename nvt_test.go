@@ -0,0 +1,42 @@
+package tclientlib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNVTDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EOLPolicy
+		chunks []string
+		want   string
+	}{
+		{"raw CR NUL", EOLRaw, []string{"a\r\x00b"}, "a\rb"},
+		{"raw CR LF", EOLRaw, []string{"a\r\nb"}, "a\r\nb"},
+		{"raw CR NUL split", EOLRaw, []string{"a\r", "\x00b"}, "a\rb"},
+		{"raw CR LF split", EOLRaw, []string{"a\r", "\nb"}, "a\r\nb"},
+		{"raw bare CR split", EOLRaw, []string{"a\r", "b"}, "a\rb"},
+		{"crlf CR NUL", EOLCRLF, []string{"a\r\x00b"}, "a\rb"},
+		{"crlf CR LF", EOLCRLF, []string{"a\r\nb"}, "a\nb"},
+		{"crlf CR NUL split", EOLCRLF, []string{"a\r", "\x00b"}, "a\rb"},
+		{"crlf CR LF split", EOLCRLF, []string{"a\r", "\nb"}, "a\nb"},
+		{"crlf bare CR split", EOLCRLF, []string{"a\r", "b"}, "a\rb"},
+		{"crlf CR at end of each chunk", EOLCRLF, []string{"\r", "\n\r", "\x00"}, "\n\r"},
+		{"crnul CR LF split", EOLCRNUL, []string{"\r", "\n"}, "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				s   nvtState
+				got []byte
+			)
+			for _, chunk := range tt.chunks {
+				got = append(got, s.decode([]byte(chunk), tt.policy)...)
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
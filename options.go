@@ -13,21 +13,51 @@ type OptionPacket struct {
 	Parameters  []byte // SB parameters
 }
 
+func (p OptionPacket) IsCommand() bool {
+	switch p.OptionCode {
+	case WILL, WONT, DO, DONT, SB:
+		return false
+	}
+	return true
+}
+
 func (p OptionPacket) Bytes() []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(IAC)
 	buf.WriteByte(p.OptionCode)
+	if p.IsCommand() {
+		return buf.Bytes()
+	}
 	buf.WriteByte(p.CommandCode)
 	if p.Parameters != nil {
-		buf.Write(p.Parameters)
+		buf.Write(escapeIAC(p.Parameters))
 		buf.WriteByte(IAC)
 		buf.WriteByte(SE)
 	}
 	return buf.Bytes()
 }
 
+// escapeIAC 将数据中的 IAC 转义为 IAC IAC
+func escapeIAC(p []byte) []byte {
+	count := bytes.Count(p, []byte{IAC})
+	if count == 0 {
+		return p
+	}
+	escaped := make([]byte, 0, len(p)+count)
+	for _, b := range p {
+		if b == IAC {
+			escaped = append(escaped, IAC)
+		}
+		escaped = append(escaped, b)
+	}
+	return escaped
+}
+
 func (p OptionPacket) String() string {
 	var builder strings.Builder
+	if p.IsCommand() {
+		return fmt.Sprintf("IAC %s", CodeTOASCII[p.OptionCode])
+	}
 	builder.WriteString(fmt.Sprintf("IAC %s %s",
 		CodeTOASCII[p.OptionCode],
 		CodeTOASCII[p.CommandCode]))
@@ -71,48 +101,38 @@ func ConvertSubOptions(commandCode byte, parameters []byte) string {
 	}
 }
 
+// ReadOptionPacket 解析 p 中第一个 IAC 处的协议包, rest 为去除该协议包后的数据。
+// 不完整的协议包不会被保留, 连续的数据流请使用 Decoder。
+//
+// Deprecated: use Decoder.
 func ReadOptionPacket(p []byte) (packet OptionPacket, rest []byte, ok bool) {
-	if len(p) < 3 {
-		return packet, p, false
-	}
 	indexIAC := bytes.IndexByte(p, IAC)
 	if indexIAC < 0 {
 		return packet, p, false
 	}
-	rest = make([]byte, 0, len(p))
-	rest = append(rest, p[:indexIAC]...)
-
-	if len(p[indexIAC:]) >= 3 {
-		packet.OptionCode = p[indexIAC+1]
-		packet.CommandCode = p[indexIAC+2]
-		remain := p[indexIAC+3:]
-		switch packet.OptionCode {
-		case WILL, WONT, DO, DONT:
-			rest = append(rest, remain...)
-			return packet, rest, true
-		case SB:
-			indexSE := bytes.IndexByte(remain, SE)
-			if indexSE < 0 {
-				traceLogf("failed index SE: packet(%s) %v\r\n", packet, remain)
-				// ENVIRON valid send no var
-				rest = append(rest, remain...)
-				return packet, p, false
-			}
-			packet.Parameters = make([]byte, len(remain[:indexSE])-1)
-			copy(packet.Parameters, remain[:indexSE])
-			rest = append(rest, remain[indexSE+1:]...)
-			return packet, rest, true
-		default:
-			traceLogf("failed found packet %s %v\r\n", packet, remain)
+	var d Decoder
+	for i := indexIAC; i < len(p); i++ {
+		tokens := d.Decode(p[i : i+1])
+		if len(tokens) == 0 {
+			continue
+		}
+		if tokens[0].Packet == nil {
+			// IAC IAC 为转义数据
+			break
 		}
+		end := i + 1
+		if tokens[0].Packet.OptionCode == SB && p[i] != SE {
+			// 子协商被其他命令结束, 该命令从前一个 IAC 开始, 保留在 rest 中
+			end = i - 1
+		}
+		rest = make([]byte, 0, len(p))
+		rest = append(rest, p[:indexIAC]...)
+		rest = append(rest, p[end:]...)
+		return *tokens[0].Packet, rest, true
 	}
 	return packet, p, false
 }
 
-func parseParameters(commandCode byte, f func(params []byte, result interface{}) error) {
-
-}
-
 /*
 CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build
 */
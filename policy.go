@@ -0,0 +1,44 @@
+package tclientlib
+
+import (
+	"bytes"
+)
+
+// OptionPolicy 是允许服务端启用的选项列表, 不在列表中的选项一律拒绝。
+// 在列表中的选项还需要对应的 OptionHandler 同意, 如 LINEMODE 还需要设置 Config.Linemode。
+// Client.Status、Client.ComPort 等主动请求的选项同样需要在列表中, 否则返回 ErrOptionRefused;
+// 本端 BINARY 例外, 只能由 Client.SetBinary 启用, 不需要在 Local 中
+type OptionPolicy struct {
+	// Local 是允许本端启用的选项, 对应服务端的 DO
+	Local []byte
+	// Remote 是允许服务端启用的选项, 对应服务端的 WILL
+	Remote []byte
+
+	custom bool // 是否允许通过 WithOptionHandler 注册了处理的选项
+}
+
+// StrictOptionPolicy 只允许登录交互必需的选项
+func StrictOptionPolicy() *OptionPolicy {
+	return &OptionPolicy{
+		Local:  []byte{NAWS, TTYPE, START_TLS},
+		Remote: []byte{ECHO, SGA},
+	}
+}
+
+// PermissiveOptionPolicy 允许所有 client 实现了的选项, 以及通过 WithOptionHandler 注册了处理的选项,
+// 是 Config.OptionPolicy 为空时的默认值
+func PermissiveOptionPolicy() *OptionPolicy {
+	return &OptionPolicy{
+		Local: []byte{NAWS, TTYPE, TSPEED, XDISPLOC, OLD_ENVIRON, NEW_ENVIRON,
+			LINEMODE, LFLOW, STATUS, CHARSET, START_TLS, COM_PORT_OPTION},
+		Remote: []byte{BINARY, ECHO, SGA, STATUS, CHARSET, EOR},
+		custom: true,
+	}
+}
+
+func (p *OptionPolicy) allowed(code byte, local bool) bool {
+	if local {
+		return bytes.IndexByte(p.Local, code) >= 0
+	}
+	return bytes.IndexByte(p.Remote, code) >= 0
+}
@@ -0,0 +1,81 @@
+package tclientlib
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExplicitRequestPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(c *Client, ctx context.Context) error
+		option  byte
+	}{
+		{
+			name: "Status",
+			request: func(c *Client, ctx context.Context) error {
+				_, err := c.Status(ctx)
+				return err
+			},
+			option: STATUS,
+		},
+		{
+			name: "ComPort",
+			request: func(c *Client, ctx context.Context) error {
+				_, err := c.ComPort(ctx)
+				return err
+			},
+			option: COM_PORT_OPTION,
+		},
+		{
+			name: "SetBinary",
+			request: func(c *Client, ctx context.Context) error {
+				return c.SetBinary(ctx, true)
+			},
+			option: BINARY,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			var (
+				mux      sync.Mutex
+				received []byte
+			)
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					n, err := server.Read(buf)
+					if err != nil {
+						return
+					}
+					mux.Lock()
+					received = append(received, buf[:n]...)
+					mux.Unlock()
+				}
+			}()
+			conf := &Config{OptionPolicy: StrictOptionPolicy()}
+			c, err := NewClientConn(client, conf, WithLogger(func(string, ...interface{}) {}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := tt.request(c, ctx); err != ErrOptionRefused {
+				t.Fatalf("error = %v, want %v", err, ErrOptionRefused)
+			}
+			mux.Lock()
+			defer mux.Unlock()
+			for _, verb := range []byte{WILL, DO} {
+				if bytes.Contains(received, []byte{IAC, verb, tt.option}) {
+					t.Errorf("sent %v for option forbidden by policy: %v", verb, received)
+				}
+			}
+		})
+	}
+}
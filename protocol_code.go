@@ -15,6 +15,11 @@ const (
 
 // 参考 https://www.iana.org/assignments/telnet-options/telnet-options.xhtml
 const (
+	XEOF  = 236 // End of file
+	SUSP  = 237 // Suspend process
+	ABORT = 238 // Abort process
+	XEOR  = 239 // End of record
+
 	SE = 240 // Subnegotiation End
 
 	NOP = 241 // No Operation
@@ -79,4 +84,15 @@ const (
 	AUTHENTICATION = 37 // Authenticate
 	ENCRYPT        = 38 // Encryption option
 	NEW_ENVIRON    = 39 // New - Environment variables
+
+	CHARSET         = 42 // Charset
+	COM_PORT_OPTION = 44 // Com Port Control Option
+	START_TLS       = 46 // Telnet START_TLS (draft-altman-telnet-starttls)
+)
+
+// 子协商命令
+const (
+	TELQUAL_IS   = 0
+	TELQUAL_SEND = 1
+	TELQUAL_INFO = 2
 )
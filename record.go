@@ -0,0 +1,49 @@
+package tclientlib
+
+// ReadRecord 读取到下一个记录边界为止的数据。服务端在协商 EOR(RFC 885) 后发送的 IAC EOR,
+// 以及 IAC GA 都会作为记录边界, 通常标记一个完整的提示符。
+// 已经由 Client.Read 读取的数据不会再返回, 连续的边界会返回空记录
+func (c *Client) ReadRecord() ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for len(c.recordEnds) == 0 {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+	delivered := c.received - int64(len(c.readBuf))
+	n := int(c.recordEnds[0] - delivered)
+	record := make([]byte, n)
+	copy(record, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	c.recordEnds = c.recordEnds[1:]
+	c.releaseTimingMarks()
+	return record, nil
+}
+
+// markRecord 在当前数据位置记录边界, 调用时需要持有 c.mux
+func (c *Client) markRecord() {
+	c.recordEnds = append(c.recordEnds, c.received)
+}
+
+// dropRecords 丢弃已经被 Client.Read 读过的边界, 调用时需要持有 c.mux
+func (c *Client) dropRecords() {
+	delivered := c.received - int64(len(c.readBuf))
+	for len(c.recordEnds) > 0 && c.recordEnds[0] <= delivered {
+		c.recordEnds = c.recordEnds[1:]
+	}
+}
+
+type eorHandler struct{}
+
+func (eorHandler) Accept(c *Client, local bool) bool {
+	return !local
+}
+
+func (eorHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (eorHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	return nil
+}
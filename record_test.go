@@ -0,0 +1,95 @@
+package tclientlib
+
+import (
+	"testing"
+)
+
+func TestReadRecord(t *testing.T) {
+	type step struct {
+		tokens []Token // 输入 handleTokens 的数据
+		read   int     // 大于 0 时调用 Read, 否则调用 ReadRecord
+		want   string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "partial read then record",
+			steps: []step{
+				{tokens: []Token{dataToken("abcdef"), packetToken(GA, 0), dataToken("gh"), packetToken(XEOR, 0)}},
+				{read: 2, want: "ab"},
+				{want: "cdef"},
+				{want: "gh"},
+			},
+		},
+		{
+			name: "back to back boundaries",
+			steps: []step{
+				{tokens: []Token{dataToken("ab"), packetToken(GA, 0), packetToken(XEOR, 0), dataToken("c"), packetToken(GA, 0)}},
+				{want: "ab"},
+				{want: ""},
+				{want: "c"},
+			},
+		},
+		{
+			name: "read up to boundary drops it",
+			steps: []step{
+				{tokens: []Token{dataToken("ab"), packetToken(GA, 0), dataToken("cd"), packetToken(GA, 0)}},
+				{read: 2, want: "ab"},
+				{want: "cd"},
+			},
+		},
+		{
+			name: "read past boundaries",
+			steps: []step{
+				{tokens: []Token{dataToken("ab"), packetToken(GA, 0), dataToken("cd"), packetToken(GA, 0), dataToken("e")}},
+				{read: 5, want: "abcde"},
+				{tokens: []Token{dataToken("f"), packetToken(GA, 0)}},
+				{want: "f"},
+			},
+		},
+		{
+			name: "record split across inputs",
+			steps: []step{
+				{tokens: []Token{dataToken("ab")}},
+				{read: 1, want: "a"},
+				{tokens: []Token{dataToken("cd"), packetToken(GA, 0)}},
+				{want: "bcd"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTokenClient()
+			for i, s := range tt.steps {
+				if s.tokens != nil {
+					if err := c.handleTokens(s.tokens); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				var got []byte
+				if s.read > 0 {
+					buf := make([]byte, s.read)
+					n, err := c.Read(buf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = buf[:n]
+				} else {
+					var err error
+					if got, err = c.ReadRecord(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if string(got) != s.want {
+					t.Fatalf("step %d = %q, want %q", i, got, s.want)
+				}
+			}
+			if len(c.readBuf) != 0 || len(c.recordEnds) != 0 {
+				t.Errorf("left readBuf %q recordEnds %v", c.readBuf, c.recordEnds)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package tclientlib
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// START_TLS 子协商命令
+const TLS_FOLLOWS = 1
+
+var (
+	ErrTLSRefused    = errors.New("START_TLS refused")
+	ErrTLSServerName = errors.New("START_TLS: TLSConfig.ServerName is required to verify the server certificate")
+)
+
+type tlsState struct {
+	pending     bool // 已回复 FOLLOWS, 等待 TLS 握手
+	established bool
+}
+
+func (c *Client) handleStartTLS(params []byte) []OptionPacket {
+	if len(params) == 0 || params[0] != TLS_FOLLOWS || c.tls.established {
+		return nil
+	}
+	c.tls.pending = true
+	return []OptionPacket{{OptionCode: SB, CommandCode: START_TLS, Parameters: []byte{TLS_FOLLOWS}}}
+}
+
+// upgradeTLS 在当前连接上进行 TLS 握手, 完成后 telnet 会话回到初始状态
+func (c *Client) upgradeTLS() error {
+	c.tls.pending = false
+	tlsConf, err := c.conf.startTLSConfig()
+	if err != nil {
+		return err
+	}
+	conn := tls.Client(c.sock, tlsConf)
+	_ = conn.SetDeadline(time.Now().Add(c.conf.Timeout))
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("START_TLS handshake: %s", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	c.sock = conn
+	c.tls.established = true
+	c.decoder.Reset()
+	c.optMux.Lock()
+	c.options = [256]optionState{}
+	c.optMux.Unlock()
+	c.ttypeIndex = 0
+	c.LogF("[Telnet client] START_TLS established")
+	return nil
+}
+
+// negotiateTLS 在登录前发送 WILL START_TLS, 等待服务端完成 TLS 升级或拒绝,
+// Config.OptionPolicy 不允许 START_TLS 时按服务端拒绝处理
+func (c *Client) negotiateTLS() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, err := c.conf.startTLSConfig(); err != nil {
+		return err
+	}
+	if !c.acceptOption(START_TLS, true) {
+		return c.tlsUnavailable(ErrTLSRefused)
+	}
+	if err := c.requestOption(START_TLS, true, true); err != nil && err != ErrOptionNegotiating {
+		return err
+	}
+	_ = c.sock.SetReadDeadline(time.Now().Add(c.conf.Timeout))
+	defer func() {
+		_ = c.sock.SetReadDeadline(time.Time{})
+	}()
+	for !c.tls.established {
+		if c.localRefused(START_TLS) {
+			return c.tlsUnavailable(ErrTLSRefused)
+		}
+		if err := c.fill(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return c.tlsUnavailable(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// startTLS 报告是否需要在登录前进行 START_TLS
+func (conf *Config) startTLS() bool {
+	return conf.TLSConfig != nil || conf.RequireTLS || len(conf.TLSFingerprints) > 0
+}
+
+// startTLSConfig 生成 START_TLS 使用的 TLS 配置, 连接的对端地址不能作为主机名,
+// 需要校验证书链时必须在 Config.TLSConfig 中设置 ServerName
+func (conf *Config) startTLSConfig() (*tls.Config, error) {
+	tlsConf, err := conf.tlsClientConfig("")
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf.ServerName == "" && !tlsConf.InsecureSkipVerify {
+		return nil, ErrTLSServerName
+	}
+	return tlsConf, nil
+}
+
+func (c *Client) tlsUnavailable(err error) error {
+	if c.conf.RequireTLS {
+		return err
+	}
+	c.LogF("[Telnet client] continue without TLS: %s", err)
+	return nil
+}
+
+// localRefused 报告本端选项是否已被服务端拒绝或关闭
+func (c *Client) localRefused(code byte) bool {
+	c.optMux.Lock()
+	defer c.optMux.Unlock()
+	return c.options[code].us.state == qNo
+}
+
+type startTLSHandler struct{}
+
+func (startTLSHandler) Accept(c *Client, local bool) bool {
+	return local && c.conf.startTLS() && !c.tls.established
+}
+
+func (startTLSHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (startTLSHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	if !c.LocalEnabled(START_TLS) {
+		return nil
+	}
+	return c.handleStartTLS(params)
+}
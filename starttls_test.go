@@ -0,0 +1,92 @@
+package tclientlib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// refuseStartTLS 模拟拒绝 START_TLS 的服务端, 返回收到的全部数据
+func refuseStartTLS(conn net.Conn) func() []byte {
+	var (
+		mux      sync.Mutex
+		received []byte
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		d := NewDecoder()
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			mux.Lock()
+			received = append(received, buf[:n]...)
+			mux.Unlock()
+			for _, tk := range d.Decode(buf[:n]) {
+				if p := tk.Packet; p != nil && p.OptionCode == WILL {
+					go conn.Write([]byte{IAC, DONT, p.CommandCode})
+				}
+			}
+		}
+	}()
+	return func() []byte {
+		<-done
+		mux.Lock()
+		defer mux.Unlock()
+		return received
+	}
+}
+
+func TestStartTLSRequired(t *testing.T) {
+	fingerprint := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		conf    Config
+		wantErr error
+	}{
+		{
+			name:    "RequireTLS without TLSConfig",
+			conf:    Config{RequireTLS: true},
+			wantErr: ErrTLSServerName,
+		},
+		{
+			name:    "RequireTLS with fingerprints only",
+			conf:    Config{RequireTLS: true, TLSFingerprints: []string{fingerprint}},
+			wantErr: ErrTLSRefused,
+		},
+		{
+			name:    "RequireTLS with TLSConfig",
+			conf:    Config{RequireTLS: true, TLSConfig: &tls.Config{ServerName: "example.com"}},
+			wantErr: ErrTLSRefused,
+		},
+		{
+			name:    "missing ServerName",
+			conf:    Config{TLSConfig: &tls.Config{}},
+			wantErr: ErrTLSServerName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			received := refuseStartTLS(server)
+			conf := tt.conf
+			conf.Username = "admin"
+			conf.Password = "secret"
+			conf.Timeout = time.Second
+			_, err := NewClientConn(client, &conf, WithLogger(func(string, ...interface{}) {}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+				t.Fatalf("NewClientConn() error = %v, want %v", err, tt.wantErr)
+			}
+			if data := received(); bytes.Contains(data, []byte("admin")) {
+				t.Errorf("username sent in plaintext: %q", data)
+			}
+		})
+	}
+}
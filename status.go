@@ -0,0 +1,178 @@
+package tclientlib
+
+import (
+	"context"
+	"strings"
+)
+
+// StatusReport 是服务端通过 STATUS IS(RFC 859) 报告的选项状态
+type StatusReport struct {
+	Will            []byte         // 服务端已启用的选项
+	Do              []byte         // 服务端要求 client 启用且已生效的选项
+	Subnegotiations []OptionPacket // 服务端报告的子协商参数
+}
+
+func (r *StatusReport) String() string {
+	items := make([]string, 0, len(r.Will)+len(r.Do)+len(r.Subnegotiations))
+	for _, code := range r.Will {
+		items = append(items, "WILL "+CodeTOASCII[code])
+	}
+	for _, code := range r.Do {
+		items = append(items, "DO "+CodeTOASCII[code])
+	}
+	for i := range r.Subnegotiations {
+		items = append(items, r.Subnegotiations[i].String())
+	}
+	return strings.Join(items, ", ")
+}
+
+// Status 向服务端请求 STATUS, 服务端未启用 STATUS 时会先发送 DO STATUS。
+// 回复由 Client.Read 处理, 调用时需要有其他 goroutine 在读取数据。
+func (c *Client) Status(ctx context.Context) (*StatusReport, error) {
+	if err := c.enableOption(ctx, STATUS, false); err != nil {
+		return nil, err
+	}
+	received := c.waitStatus()
+	defer c.cancelWaitStatus(received)
+	packet := OptionPacket{OptionCode: SB, CommandCode: STATUS, Parameters: []byte{TELQUAL_SEND}}
+	if err := c.replyOptionPackets(packet); err != nil {
+		return nil, err
+	}
+	select {
+	case report := <-received:
+		return report, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) handleStatus(params []byte) []OptionPacket {
+	if len(params) == 0 {
+		return nil
+	}
+	switch params[0] {
+	case TELQUAL_SEND:
+		if !c.LocalEnabled(STATUS) {
+			return nil
+		}
+		return []OptionPacket{{OptionCode: SB, CommandCode: STATUS, Parameters: c.statusReply()}}
+	case TELQUAL_IS:
+		if !c.RemoteEnabled(STATUS) {
+			return nil
+		}
+		c.notifyStatus(parseStatusReport(params[1:]))
+	}
+	return nil
+}
+
+// statusReply 根据本端的选项状态生成 STATUS IS 的内容, 数据中的 SE 需要重复一次
+func (c *Client) statusReply() []byte {
+	params := []byte{TELQUAL_IS}
+	c.optMux.Lock()
+	for code := range c.options {
+		if c.options[code].us.enabled() {
+			params = appendStatusBytes(params, WILL, byte(code))
+		}
+		if c.options[code].him.enabled() {
+			params = appendStatusBytes(params, DO, byte(code))
+		}
+	}
+	nawsEnabled := c.options[NAWS].us.enabled()
+	c.optMux.Unlock()
+	if nawsEnabled {
+		naws := nawsPacket(c.conf.TTYOptions.Wide, c.conf.TTYOptions.High)
+		params = append(params, SB, NAWS)
+		params = appendStatusBytes(params, naws.Parameters...)
+		params = append(params, SE)
+	}
+	return params
+}
+
+func appendStatusBytes(params []byte, data ...byte) []byte {
+	for _, b := range data {
+		if b == SE {
+			params = append(params, SE)
+		}
+		params = append(params, b)
+	}
+	return params
+}
+
+func parseStatusReport(params []byte) *StatusReport {
+	var report StatusReport
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case WILL, DO:
+			if i+1 >= len(params) {
+				return &report
+			}
+			if params[i] == WILL {
+				report.Will = append(report.Will, params[i+1])
+			} else {
+				report.Do = append(report.Do, params[i+1])
+			}
+			i++
+		case SB:
+			if i+1 >= len(params) {
+				return &report
+			}
+			packet := OptionPacket{OptionCode: SB, CommandCode: params[i+1], Parameters: make([]byte, 0)}
+			for i += 2; i < len(params); i++ {
+				if params[i] == SE {
+					if i+1 < len(params) && params[i+1] == SE {
+						i++
+					} else {
+						break
+					}
+				}
+				packet.Parameters = append(packet.Parameters, params[i])
+			}
+			report.Subnegotiations = append(report.Subnegotiations, packet)
+		default:
+			traceLogf("[Telnet client] unknown status byte %d\r\n", params[i])
+		}
+	}
+	return &report
+}
+
+func (c *Client) waitStatus() chan *StatusReport {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	ch := make(chan *StatusReport, 1)
+	c.statusWaiters = append(c.statusWaiters, ch)
+	return ch
+}
+
+func (c *Client) cancelWaitStatus(ch chan *StatusReport) {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	for i := range c.statusWaiters {
+		if c.statusWaiters[i] == ch {
+			c.statusWaiters = append(c.statusWaiters[:i], c.statusWaiters[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *Client) notifyStatus(report *StatusReport) {
+	c.waitMux.Lock()
+	defer c.waitMux.Unlock()
+	for _, ch := range c.statusWaiters {
+		ch <- report
+	}
+	c.statusWaiters = nil
+}
+
+type statusHandler struct{}
+
+func (statusHandler) Accept(c *Client, local bool) bool {
+	return true
+}
+
+func (statusHandler) Changed(c *Client, local, enabled bool) []OptionPacket {
+	return nil
+}
+
+func (statusHandler) Subnegotiation(c *Client, params []byte) []OptionPacket {
+	return c.handleStatus(params)
+}
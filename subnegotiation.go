@@ -0,0 +1,430 @@
+package tclientlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSubnegotiation     = errors.New("invalid subnegotiation")
+	ErrUnsupportedSubnegotiation = errors.New("unsupported subnegotiation")
+)
+
+// Subnegotiation 是子协商参数(IAC SB <option> 与 IAC SE 之间的内容)的结构化表示
+type Subnegotiation interface {
+	// Option 返回子协商对应的选项
+	Option() byte
+	// Marshal 返回未转义 IAC 的参数
+	Marshal() ([]byte, error)
+	// Unmarshal 解析未转义 IAC 的参数
+	Unmarshal(params []byte) error
+}
+
+// Decode 将 SB 协议包的参数解析为对应的 Subnegotiation, 如 *WindowSize、*TerminalType
+func (p OptionPacket) Decode() (Subnegotiation, error) {
+	if p.OptionCode != SB {
+		return nil, ErrInvalidSubnegotiation
+	}
+	return parseParameters(p.CommandCode, p.Parameters)
+}
+
+// EncodeSubnegotiation 生成 Subnegotiation 对应的 SB 协议包
+func EncodeSubnegotiation(s Subnegotiation) (OptionPacket, error) {
+	params, err := s.Marshal()
+	if err != nil {
+		return OptionPacket{}, err
+	}
+	return OptionPacket{OptionCode: SB, CommandCode: s.Option(), Parameters: params}, nil
+}
+
+func parseParameters(commandCode byte, params []byte) (Subnegotiation, error) {
+	var s Subnegotiation
+	switch commandCode {
+	case NAWS:
+		s = &WindowSize{}
+	case TTYPE:
+		s = &TerminalType{}
+	case TSPEED:
+		s = &TerminalSpeed{}
+	case NEW_ENVIRON, OLD_ENVIRON:
+		s = &Environ{Code: commandCode}
+	case LINEMODE:
+		s = &Linemode{}
+	case STATUS:
+		s = &Status{}
+	case CHARSET:
+		s = &Charset{}
+	case COM_PORT_OPTION:
+		s = &ComPortCommand{}
+	default:
+		return nil, ErrUnsupportedSubnegotiation
+	}
+	if err := s.Unmarshal(params); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WindowSize 是 NAWS(RFC 1073) 的窗口大小
+type WindowSize struct {
+	Width  uint16
+	Height uint16
+}
+
+func (WindowSize) Option() byte {
+	return NAWS
+}
+
+func (s WindowSize) Marshal() ([]byte, error) {
+	params := make([]byte, 4)
+	binary.BigEndian.PutUint16(params[:2], s.Width)
+	binary.BigEndian.PutUint16(params[2:], s.Height)
+	return params, nil
+}
+
+func (s *WindowSize) Unmarshal(params []byte) error {
+	if len(params) != 4 {
+		return ErrInvalidSubnegotiation
+	}
+	s.Width = binary.BigEndian.Uint16(params[:2])
+	s.Height = binary.BigEndian.Uint16(params[2:])
+	return nil
+}
+
+// TerminalType 是 TTYPE(RFC 1091) 的 SEND 请求或 IS 回复
+type TerminalType struct {
+	Command byte // TELQUAL_IS 或 TELQUAL_SEND
+	Name    string
+}
+
+func (TerminalType) Option() byte {
+	return TTYPE
+}
+
+func (t TerminalType) Marshal() ([]byte, error) {
+	switch t.Command {
+	case TELQUAL_SEND:
+		return []byte{TELQUAL_SEND}, nil
+	case TELQUAL_IS:
+		return append([]byte{TELQUAL_IS}, t.Name...), nil
+	}
+	return nil, ErrInvalidSubnegotiation
+}
+
+func (t *TerminalType) Unmarshal(params []byte) error {
+	if len(params) == 0 || (params[0] != TELQUAL_IS && params[0] != TELQUAL_SEND) {
+		return ErrInvalidSubnegotiation
+	}
+	t.Command = params[0]
+	t.Name = string(params[1:])
+	return nil
+}
+
+// TerminalSpeed 是 TSPEED(RFC 1079) 的 SEND 请求或 IS 回复
+type TerminalSpeed struct {
+	Command  byte // TELQUAL_IS 或 TELQUAL_SEND
+	Transmit int
+	Receive  int
+}
+
+func (TerminalSpeed) Option() byte {
+	return TSPEED
+}
+
+func (t TerminalSpeed) Marshal() ([]byte, error) {
+	switch t.Command {
+	case TELQUAL_SEND:
+		return []byte{TELQUAL_SEND}, nil
+	case TELQUAL_IS:
+		return append([]byte{TELQUAL_IS}, fmt.Sprintf("%d,%d", t.Transmit, t.Receive)...), nil
+	}
+	return nil, ErrInvalidSubnegotiation
+}
+
+func (t *TerminalSpeed) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	switch params[0] {
+	case TELQUAL_SEND:
+		*t = TerminalSpeed{Command: TELQUAL_SEND}
+		return nil
+	case TELQUAL_IS:
+		speeds := strings.Split(string(params[1:]), ",")
+		if len(speeds) != 2 {
+			return ErrInvalidSubnegotiation
+		}
+		transmit, err := strconv.Atoi(speeds[0])
+		if err != nil {
+			return ErrInvalidSubnegotiation
+		}
+		receive, err := strconv.Atoi(speeds[1])
+		if err != nil {
+			return ErrInvalidSubnegotiation
+		}
+		*t = TerminalSpeed{Command: TELQUAL_IS, Transmit: transmit, Receive: receive}
+		return nil
+	}
+	return ErrInvalidSubnegotiation
+}
+
+// EnvironVar 是 NEW_ENVIRON 中的一个变量, SEND 请求中只有变量名, Defined 为 false
+type EnvironVar struct {
+	Type    byte // ENV_VAR 或 ENV_USERVAR
+	Name    string
+	Value   string
+	Defined bool
+}
+
+// Environ 是 NEW_ENVIRON(RFC 1572) 或 OLD_ENVIRON(RFC 1408) 的 SEND、IS 或 INFO
+type Environ struct {
+	Code    byte // NEW_ENVIRON 或 OLD_ENVIRON
+	Command byte // TELQUAL_IS、TELQUAL_SEND 或 TELQUAL_INFO
+	Vars    []EnvironVar
+}
+
+func (e Environ) Option() byte {
+	return e.Code
+}
+
+func (e Environ) Marshal() ([]byte, error) {
+	switch e.Command {
+	case TELQUAL_IS, TELQUAL_SEND, TELQUAL_INFO:
+	default:
+		return nil, ErrInvalidSubnegotiation
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(e.Command)
+	for _, v := range e.Vars {
+		writeEnvironVar(&buf, v.Type, v.Name, v.Value, v.Defined)
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *Environ) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	switch params[0] {
+	case TELQUAL_IS, TELQUAL_SEND, TELQUAL_INFO:
+	default:
+		return ErrInvalidSubnegotiation
+	}
+	e.Command = params[0]
+	e.Vars = parseEnvironVars(params[1:])
+	return nil
+}
+
+// SLCTriplet 是 LINEMODE SLC 中的一个特殊字符
+type SLCTriplet struct {
+	Function byte
+	Flags    byte
+	Value    byte
+}
+
+// Linemode 是 LINEMODE(RFC 1184) 的子协商, Command 为 LM_MODE、LM_SLC,
+// 或者对 FORWARDMASK 的 DO、DONT、WILL、WONT
+type Linemode struct {
+	Command     byte
+	Mode        LinemodeMode // LM_MODE, 可能包含 MODE_ACK
+	SLC         []SLCTriplet // LM_SLC
+	ForwardMask []byte       // DO FORWARDMASK
+}
+
+func (Linemode) Option() byte {
+	return LINEMODE
+}
+
+func (l Linemode) Marshal() ([]byte, error) {
+	switch l.Command {
+	case LM_MODE:
+		return []byte{LM_MODE, byte(l.Mode)}, nil
+	case LM_SLC:
+		params := make([]byte, 0, 1+3*len(l.SLC))
+		params = append(params, LM_SLC)
+		for _, t := range l.SLC {
+			params = append(params, t.Function, t.Flags, t.Value)
+		}
+		return params, nil
+	case DO:
+		return append([]byte{DO, LM_FORWARDMASK}, l.ForwardMask...), nil
+	case DONT, WILL, WONT:
+		return []byte{l.Command, LM_FORWARDMASK}, nil
+	}
+	return nil, ErrInvalidSubnegotiation
+}
+
+func (l *Linemode) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	*l = Linemode{Command: params[0]}
+	switch params[0] {
+	case LM_MODE:
+		if len(params) != 2 {
+			return ErrInvalidSubnegotiation
+		}
+		l.Mode = LinemodeMode(params[1])
+		return nil
+	case LM_SLC:
+		if (len(params)-1)%3 != 0 {
+			return ErrInvalidSubnegotiation
+		}
+		for i := 1; i+2 < len(params); i += 3 {
+			l.SLC = append(l.SLC, SLCTriplet{Function: params[i], Flags: params[i+1], Value: params[i+2]})
+		}
+		return nil
+	case DO, DONT, WILL, WONT:
+		if len(params) < 2 || params[1] != LM_FORWARDMASK {
+			return ErrInvalidSubnegotiation
+		}
+		if params[0] == DO {
+			l.ForwardMask = append([]byte(nil), params[2:]...)
+		}
+		return nil
+	}
+	return ErrInvalidSubnegotiation
+}
+
+// Status 是 STATUS(RFC 859) 的 SEND 请求或 IS 回复
+type Status struct {
+	Command byte // TELQUAL_IS 或 TELQUAL_SEND
+	Report  StatusReport
+}
+
+func (Status) Option() byte {
+	return STATUS
+}
+
+func (s Status) Marshal() ([]byte, error) {
+	switch s.Command {
+	case TELQUAL_SEND:
+		return []byte{TELQUAL_SEND}, nil
+	case TELQUAL_IS:
+		params := []byte{TELQUAL_IS}
+		for _, code := range s.Report.Will {
+			params = appendStatusBytes(params, WILL, code)
+		}
+		for _, code := range s.Report.Do {
+			params = appendStatusBytes(params, DO, code)
+		}
+		for _, sub := range s.Report.Subnegotiations {
+			params = append(params, SB)
+			params = appendStatusBytes(params, sub.CommandCode)
+			params = appendStatusBytes(params, sub.Parameters...)
+			params = append(params, SE)
+		}
+		return params, nil
+	}
+	return nil, ErrInvalidSubnegotiation
+}
+
+func (s *Status) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	switch params[0] {
+	case TELQUAL_SEND:
+		*s = Status{Command: TELQUAL_SEND}
+		return nil
+	case TELQUAL_IS:
+		*s = Status{Command: TELQUAL_IS, Report: *parseStatusReport(params[1:])}
+		return nil
+	}
+	return ErrInvalidSubnegotiation
+}
+
+// Charset 是 CHARSET(RFC 2066) 的子协商。REQUEST 中 Charsets 为可选的字符集, 解析时忽略 [TTABLE] 前缀;
+// ACCEPTED 中 Charsets 只有一个; TTABLE-IS 等转换表命令的内容保存在 Data 中
+type Charset struct {
+	Command   byte
+	Separator byte // REQUEST 的分隔符, 为 0 时使用 ';'
+	Charsets  []string
+	Data      []byte
+}
+
+func (Charset) Option() byte {
+	return CHARSET
+}
+
+func (c Charset) Marshal() ([]byte, error) {
+	params := []byte{c.Command}
+	switch c.Command {
+	case CHARSET_REQUEST:
+		sep := c.Separator
+		if sep == 0 {
+			sep = ';'
+		}
+		for _, name := range c.Charsets {
+			params = append(params, sep)
+			params = append(params, name...)
+		}
+	case CHARSET_ACCEPTED:
+		if len(c.Charsets) != 1 {
+			return nil, ErrInvalidSubnegotiation
+		}
+		params = append(params, c.Charsets[0]...)
+	case CHARSET_REJECTED, CHARSET_TTABLE_REJECTED, CHARSET_TTABLE_ACK, CHARSET_TTABLE_NAK:
+	case CHARSET_TTABLE_IS:
+		params = append(params, c.Data...)
+	default:
+		return nil, ErrInvalidSubnegotiation
+	}
+	return params, nil
+}
+
+func (c *Charset) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	*c = Charset{Command: params[0]}
+	switch params[0] {
+	case CHARSET_REQUEST:
+		c.Charsets = parseCharsetRequest(params[1:])
+		if len(c.Charsets) == 0 {
+			return ErrInvalidSubnegotiation
+		}
+		request := bytes.TrimPrefix(params[1:], []byte(charsetTTable))
+		if len(request) < len(params[1:]) {
+			// [TTABLE] 后有一个字节的版本号
+			request = request[1:]
+		}
+		c.Separator = request[0]
+	case CHARSET_ACCEPTED:
+		c.Charsets = []string{string(params[1:])}
+	case CHARSET_REJECTED, CHARSET_TTABLE_REJECTED, CHARSET_TTABLE_ACK, CHARSET_TTABLE_NAK:
+	case CHARSET_TTABLE_IS:
+		c.Data = append([]byte(nil), params[1:]...)
+	default:
+		return ErrInvalidSubnegotiation
+	}
+	return nil
+}
+
+// ComPortCommand 是 COM-PORT-OPTION(RFC 2217) 的命令, Command 为 CPO_* (服务端发送的命令加上
+// CPO_SERVER_OFFSET), Value 的格式由命令决定, 如 SET-BAUDRATE 为 4 字节大端整数
+type ComPortCommand struct {
+	Command byte
+	Value   []byte
+}
+
+func (ComPortCommand) Option() byte {
+	return COM_PORT_OPTION
+}
+
+func (c ComPortCommand) Marshal() ([]byte, error) {
+	return append([]byte{c.Command}, c.Value...), nil
+}
+
+func (c *ComPortCommand) Unmarshal(params []byte) error {
+	if len(params) == 0 {
+		return ErrInvalidSubnegotiation
+	}
+	c.Command = params[0]
+	c.Value = append([]byte(nil), params[1:]...)
+	return nil
+}
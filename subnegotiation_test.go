@@ -0,0 +1,213 @@
+package tclientlib
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSubnegotiationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sub    Subnegotiation
+		params []byte
+	}{
+		{
+			name:   "NAWS",
+			sub:    &WindowSize{Width: 80, Height: 24},
+			params: []byte{0, 80, 0, 24},
+		},
+		{
+			name:   "NAWS IAC",
+			sub:    &WindowSize{Width: 255, Height: 0xff00},
+			params: []byte{0, IAC, IAC, 0},
+		},
+		{
+			name:   "TTYPE SEND",
+			sub:    &TerminalType{Command: TELQUAL_SEND},
+			params: []byte{TELQUAL_SEND},
+		},
+		{
+			name:   "TTYPE IS",
+			sub:    &TerminalType{Command: TELQUAL_IS, Name: "XTERM"},
+			params: append([]byte{TELQUAL_IS}, "XTERM"...),
+		},
+		{
+			name:   "TSPEED SEND",
+			sub:    &TerminalSpeed{Command: TELQUAL_SEND},
+			params: []byte{TELQUAL_SEND},
+		},
+		{
+			name:   "TSPEED IS",
+			sub:    &TerminalSpeed{Command: TELQUAL_IS, Transmit: 38400, Receive: 9600},
+			params: append([]byte{TELQUAL_IS}, "38400,9600"...),
+		},
+		{
+			name:   "NEW_ENVIRON SEND all",
+			sub:    &Environ{Code: NEW_ENVIRON, Command: TELQUAL_SEND},
+			params: []byte{TELQUAL_SEND},
+		},
+		{
+			name: "NEW_ENVIRON SEND names",
+			sub: &Environ{Code: NEW_ENVIRON, Command: TELQUAL_SEND, Vars: []EnvironVar{
+				{Type: ENV_VAR, Name: "USER"},
+				{Type: ENV_USERVAR, Name: "TZ"},
+			}},
+			params: []byte{TELQUAL_SEND, ENV_VAR, 'U', 'S', 'E', 'R', ENV_USERVAR, 'T', 'Z'},
+		},
+		{
+			name: "NEW_ENVIRON IS escaped",
+			sub: &Environ{Code: NEW_ENVIRON, Command: TELQUAL_IS, Vars: []EnvironVar{
+				{Type: ENV_VAR, Name: "USER", Value: "root", Defined: true},
+				{Type: ENV_USERVAR, Name: "A\x02", Value: "\x00\x01\x02\x03", Defined: true},
+				{Type: ENV_VAR, Name: "DISPLAY"},
+			}},
+			params: []byte{TELQUAL_IS,
+				ENV_VAR, 'U', 'S', 'E', 'R', ENV_VALUE, 'r', 'o', 'o', 't',
+				ENV_USERVAR, 'A', ENV_ESC, 2, ENV_VALUE, ENV_ESC, 0, ENV_ESC, 1, ENV_ESC, 2, ENV_ESC, 3,
+				ENV_VAR, 'D', 'I', 'S', 'P', 'L', 'A', 'Y'},
+		},
+		{
+			name: "OLD_ENVIRON INFO",
+			sub: &Environ{Code: OLD_ENVIRON, Command: TELQUAL_INFO, Vars: []EnvironVar{
+				{Type: ENV_VAR, Name: "LANG", Value: "C", Defined: true},
+			}},
+			params: []byte{TELQUAL_INFO, ENV_VAR, 'L', 'A', 'N', 'G', ENV_VALUE, 'C'},
+		},
+		{
+			name:   "LINEMODE MODE",
+			sub:    &Linemode{Command: LM_MODE, Mode: MODE_EDIT | MODE_ACK},
+			params: []byte{LM_MODE, MODE_EDIT | MODE_ACK},
+		},
+		{
+			name: "LINEMODE SLC",
+			sub: &Linemode{Command: LM_SLC, SLC: []SLCTriplet{
+				{Function: SLC_IP, Flags: SLC_VALUE, Value: 3},
+			}},
+			params: []byte{LM_SLC, SLC_IP, SLC_VALUE, 3},
+		},
+		{
+			name:   "LINEMODE DO FORWARDMASK",
+			sub:    &Linemode{Command: DO, ForwardMask: []byte{0x80, 0x01}},
+			params: []byte{DO, LM_FORWARDMASK, 0x80, 0x01},
+		},
+		{
+			name:   "LINEMODE WILL FORWARDMASK",
+			sub:    &Linemode{Command: WILL},
+			params: []byte{WILL, LM_FORWARDMASK},
+		},
+		{
+			name:   "STATUS SEND",
+			sub:    &Status{Command: TELQUAL_SEND},
+			params: []byte{TELQUAL_SEND},
+		},
+		{
+			name: "STATUS IS SE doubled",
+			sub: &Status{Command: TELQUAL_IS, Report: StatusReport{
+				Will: []byte{ECHO, SGA},
+				Do:   []byte{NAWS},
+				Subnegotiations: []OptionPacket{
+					{OptionCode: SB, CommandCode: NAWS, Parameters: []byte{0, SE, 0, 24}},
+				},
+			}},
+			params: []byte{TELQUAL_IS, WILL, ECHO, WILL, SGA, DO, NAWS,
+				SB, NAWS, 0, SE, SE, 0, 24, SE},
+		},
+		{
+			name:   "CHARSET REQUEST",
+			sub:    &Charset{Command: CHARSET_REQUEST, Separator: ' ', Charsets: []string{"UTF-8", "GBK"}},
+			params: append([]byte{CHARSET_REQUEST}, " UTF-8 GBK"...),
+		},
+		{
+			name:   "CHARSET ACCEPTED",
+			sub:    &Charset{Command: CHARSET_ACCEPTED, Charsets: []string{"UTF-8"}},
+			params: append([]byte{CHARSET_ACCEPTED}, "UTF-8"...),
+		},
+		{
+			name:   "CHARSET REJECTED",
+			sub:    &Charset{Command: CHARSET_REJECTED},
+			params: []byte{CHARSET_REJECTED},
+		},
+		{
+			name:   "CHARSET TTABLE-IS",
+			sub:    &Charset{Command: CHARSET_TTABLE_IS, Data: []byte{1, 'x'}},
+			params: []byte{CHARSET_TTABLE_IS, 1, 'x'},
+		},
+		{
+			name:   "COM-PORT SET-BAUDRATE",
+			sub:    &ComPortCommand{Command: CPO_SET_BAUDRATE, Value: []byte{0, 0, 0x25, 0x80}},
+			params: []byte{CPO_SET_BAUDRATE, 0, 0, 0x25, 0x80},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := EncodeSubnegotiation(tt.sub)
+			if err != nil {
+				t.Fatalf("EncodeSubnegotiation() error = %v", err)
+			}
+			if !bytes.Equal(packet.Parameters, tt.params) {
+				t.Errorf("Marshal() = %v, want %v", packet.Parameters, tt.params)
+			}
+			got, err := packet.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.sub) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.sub)
+			}
+		})
+	}
+}
+
+func TestSubnegotiationDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  OptionPacket
+		want    Subnegotiation
+		wantErr error
+	}{
+		{
+			name: "CHARSET REQUEST with TTABLE prefix",
+			packet: OptionPacket{OptionCode: SB, CommandCode: CHARSET,
+				Parameters: append([]byte{CHARSET_REQUEST}, "[TTABLE]\x01;UTF-8;GBK"...)},
+			want: &Charset{Command: CHARSET_REQUEST, Separator: ';', Charsets: []string{"UTF-8", "GBK"}},
+		},
+		{
+			name: "CHARSET REQUEST with only TTABLE prefix",
+			packet: OptionPacket{OptionCode: SB, CommandCode: CHARSET,
+				Parameters: append([]byte{CHARSET_REQUEST}, "[TTABLE]\x01"...)},
+			wantErr: ErrInvalidSubnegotiation,
+		},
+		{
+			name:    "NAWS too short",
+			packet:  OptionPacket{OptionCode: SB, CommandCode: NAWS, Parameters: []byte{0, 80}},
+			wantErr: ErrInvalidSubnegotiation,
+		},
+		{
+			name:    "TSPEED IS malformed",
+			packet:  OptionPacket{OptionCode: SB, CommandCode: TSPEED, Parameters: append([]byte{TELQUAL_IS}, "38400"...)},
+			wantErr: ErrInvalidSubnegotiation,
+		},
+		{
+			name:    "not SB",
+			packet:  OptionPacket{OptionCode: WILL, CommandCode: NAWS},
+			wantErr: ErrInvalidSubnegotiation,
+		},
+		{
+			name:    "unsupported option",
+			packet:  OptionPacket{OptionCode: SB, CommandCode: ECHO, Parameters: []byte{1}},
+			wantErr: ErrUnsupportedSubnegotiation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.packet.Decode()
+			if err != tt.wantErr {
+				t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
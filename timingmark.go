@@ -0,0 +1,113 @@
+package tclientlib
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const defaultNegotiationQuietPeriod = 500 * time.Millisecond
+
+type timingMark struct {
+	sent    time.Time
+	elapsed time.Duration
+	flush   bool  // 是否需要等待之前的数据被 Client.Read 读取
+	offset  int64 // 收到回复时已接收的数据总量
+	done    chan struct{}
+}
+
+// TimingMark 发送 DO TM(RFC 860) 并等待服务端回复 WILL TM 或 WONT TM, 返回往返时间。
+// 返回时服务端在回复之前发送的数据都已经由 Client.Read 读取。
+// 回复由 Client.Read 处理, 调用时需要有其他 goroutine 在读取数据。
+func (c *Client) TimingMark(ctx context.Context) (time.Duration, error) {
+	mark, err := c.sendTimingMark(true)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-mark.done:
+		return mark.elapsed, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// sendTimingMark 发送 IAC DO TM, 服务端处理完之前的数据后回复 WILL TM 或 WONT TM,
+// 回复按发送顺序依次对应
+func (c *Client) sendTimingMark(flush bool) (*timingMark, error) {
+	mark := &timingMark{sent: time.Now(), flush: flush, done: make(chan struct{})}
+	c.waitMux.Lock()
+	c.markWaiters = append(c.markWaiters, mark)
+	c.waitMux.Unlock()
+	return mark, c.replyOptionPackets(OptionPacket{OptionCode: DO, CommandCode: TM})
+}
+
+// notifyTimingMark 处理服务端对 DO TM 的回复, 没有等待中的 TM 时返回 false, 按普通协商处理
+func (c *Client) notifyTimingMark() bool {
+	c.waitMux.Lock()
+	if len(c.markWaiters) == 0 {
+		c.waitMux.Unlock()
+		return false
+	}
+	mark := c.markWaiters[0]
+	c.markWaiters = c.markWaiters[1:]
+	c.waitMux.Unlock()
+
+	mark.elapsed = time.Since(mark.sent)
+	if !mark.flush {
+		close(mark.done)
+		return true
+	}
+	mark.offset = c.received
+	c.flushMarks = append(c.flushMarks, mark)
+	c.releaseTimingMarks()
+	return true
+}
+
+// releaseTimingMarks 通知之前的数据已经全部被读取的 TM, 调用时需要持有 c.mux
+func (c *Client) releaseTimingMarks() {
+	delivered := c.received - int64(len(c.readBuf))
+	for len(c.flushMarks) > 0 && c.flushMarks[0].offset <= delivered {
+		close(c.flushMarks[0].done)
+		c.flushMarks = c.flushMarks[1:]
+	}
+}
+
+// WaitNegotiated 通过 TM 往返等待服务端处理完之前的选项协商, 服务端不回应 TM 时,
+// 在 Config.NegotiationQuietPeriod 内没有收到数据即认为协商结束。
+// 期间收到的数据保留给之后的 Client.Read, 不能与 Client.Read 并发调用。
+// 返回前恢复 Client.SetReadDeadline 设置的读超时
+func (c *Client) WaitNegotiated(ctx context.Context) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	mark, err := c.sendTimingMark(false)
+	if err != nil {
+		return err
+	}
+	defer c.restoreReadDeadline()
+	for {
+		select {
+		case <-mark.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		quiet := true
+		deadline := time.Now().Add(c.conf.NegotiationQuietPeriod)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline, quiet = d, false
+		}
+		_ = c.sock.SetReadDeadline(deadline)
+		if err := c.fill(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if !quiet {
+					return context.DeadlineExceeded
+				}
+				traceLogf("[Telnet client] no timing mark reply, negotiation quiet\r\n")
+				return nil
+			}
+			return err
+		}
+	}
+}
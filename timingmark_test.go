@@ -0,0 +1,90 @@
+package tclientlib
+
+import (
+	"testing"
+)
+
+// newTokenClient 返回只通过 handleTokens 输入数据的 Client, readBuf 为空时不能调用 Read
+func newTokenClient() *Client {
+	conf := Config{}
+	conf.SetDefaults()
+	return &Client{conf: &conf, handlers: defaultOptionHandlers()}
+}
+
+func dataToken(s string) Token {
+	return Token{Data: []byte(s)}
+}
+
+func packetToken(option, command byte) Token {
+	return Token{Packet: &OptionPacket{OptionCode: option, CommandCode: command}}
+}
+
+func markDone(mark *timingMark) bool {
+	select {
+	case <-mark.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestTimingMarkFlush(t *testing.T) {
+	tests := []struct {
+		name  string
+		flush bool
+		reads []int // 每次 Read 的长度
+		done  []bool
+	}{
+		{"no flush", false, []int{1}, []bool{true, true}},
+		{"flush released after data read", true, []int{2, 1}, []bool{false, false, true}},
+		{"flush released by single read", true, []int{5}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTokenClient()
+			mark := &timingMark{flush: tt.flush, done: make(chan struct{})}
+			c.markWaiters = []*timingMark{mark}
+			tokens := []Token{dataToken("abc"), packetToken(WILL, TM), dataToken("de")}
+			if err := c.handleTokens(tokens); err != nil {
+				t.Fatal(err)
+			}
+			if got := markDone(mark); got != tt.done[0] {
+				t.Fatalf("done after reply = %v, want %v", got, tt.done[0])
+			}
+			for i, n := range tt.reads {
+				if _, err := c.Read(make([]byte, n)); err != nil {
+					t.Fatal(err)
+				}
+				if got := markDone(mark); got != tt.done[i+1] {
+					t.Fatalf("done after read %d = %v, want %v", i, got, tt.done[i+1])
+				}
+			}
+		})
+	}
+}
+
+func TestTimingMarkOrder(t *testing.T) {
+	c := newTokenClient()
+	first := &timingMark{flush: true, done: make(chan struct{})}
+	second := &timingMark{flush: true, done: make(chan struct{})}
+	c.markWaiters = []*timingMark{first, second}
+	tokens := []Token{dataToken("a"), packetToken(WONT, TM), dataToken("b"), packetToken(WILL, TM)}
+	if err := c.handleTokens(tokens); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !markDone(first) || markDone(second) {
+		t.Fatalf("after first read: first %v second %v, want true false", markDone(first), markDone(second))
+	}
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !markDone(second) {
+		t.Fatal("second mark not released")
+	}
+	if c.RemoteEnabled(TM) {
+		t.Error("TM reply should not change option state")
+	}
+}
@@ -0,0 +1,92 @@
+package tclientlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TelnetsPort 是 telnet over TLS 的默认端口
+const TelnetsPort = "992"
+
+var ErrFingerprintMismatch = errors.New("tls: certificate fingerprint mismatch")
+
+// DialTLS 建立 TLS 连接(telnets)后进行 telnet 协商和登录, addr 未指定端口时使用 992。
+// 证书校验、SNI 和客户端证书使用 Config.TLSConfig, 设置 Config.TLSFingerprints 时只校验证书指纹
+func DialTLS(network, addr string, config *Config) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, TelnetsPort)
+	}
+	tlsConf, err := config.tlsClientConfig(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	conn, err := tls.DialWithDialer(dialer, network, addr, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientConn(conn, config)
+}
+
+// tlsClientConfig 根据 Config 生成 TLS 客户端配置, 未设置 ServerName 时使用 addr 中的主机名
+func (conf *Config) tlsClientConfig(addr string) (*tls.Config, error) {
+	tlsConf := &tls.Config{}
+	if conf.TLSConfig != nil {
+		tlsConf = conf.TLSConfig.Clone()
+	}
+	if tlsConf.ServerName == "" {
+		tlsConf.ServerName = hostname(addr)
+	}
+	if len(conf.TLSFingerprints) == 0 {
+		return tlsConf, nil
+	}
+	pins := make([][]byte, 0, len(conf.TLSFingerprints))
+	for _, fingerprint := range conf.TLSFingerprints {
+		pin, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("tls: invalid SHA-256 fingerprint %q", fingerprint)
+		}
+		pins = append(pins, pin)
+	}
+	// 固定证书指纹时不校验证书链
+	verify := tlsConf.VerifyPeerCertificate
+	tlsConf.InsecureSkipVerify = true
+	tlsConf.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		if err := verifyFingerprint(rawCerts, pins); err != nil {
+			return err
+		}
+		if verify != nil {
+			return verify(rawCerts, chains)
+		}
+		return nil
+	}
+	return tlsConf, nil
+}
+
+func hostname(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// verifyFingerprint 校验服务端证书的 SHA-256 指纹
+func verifyFingerprint(rawCerts [][]byte, pins [][]byte) error {
+	if len(rawCerts) == 0 {
+		return ErrFingerprintMismatch
+	}
+	sum := sha256.Sum256(rawCerts[0])
+	for _, pin := range pins {
+		if bytes.Equal(sum[:], pin) {
+			return nil
+		}
+	}
+	return ErrFingerprintMismatch
+}